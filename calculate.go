@@ -14,21 +14,13 @@ var typeFloat32 reflect.Type
 var typeInt reflect.Type
 var typeString reflect.Type
 
-func add(a, b interface{}) (interface{}, error) {
-	if reflect.String == reflect.TypeOf(a).Kind() && reflect.String == reflect.TypeOf(b).Kind() {
-		return fmt.Sprintf("%s%s", a, b), nil
-	} else if IsNumber(reflect.TypeOf(a).Kind()) && IsNumber(reflect.TypeOf(b).Kind()) {
-		return doNumMath(a, b, token.ADD.String())
+// toBool : Operand of logic operator should be bool
+func toBool(a interface{}, op token.Token) (bool, error) {
+	b, ok := ptrElem(a).(bool)
+	if !ok {
+		return false, fmt.Errorf("Operand of %s should be bool, not %T", op, ptrElem(a))
 	}
-	return nil, fmt.Errorf("Math type not support with %T, %T", a, b)
-}
-
-func equ(a, b interface{}) (bool, error) {
-	return reflect.DeepEqual(a, b), nil
-}
-
-func neq(a, b interface{}) (bool, error) {
-	return !reflect.DeepEqual(a, b), nil
+	return b, nil
 }
 
 func getValueAndKind(input interface{}) (reflect.Value, reflect.Kind) {
@@ -93,7 +85,10 @@ func interToFloat(v interface{}) (float64, error) {
 	case *float64:
 		return *v.(*float64), nil
 	}
-	return 0, fmt.Errorf("Can not conver %s value to float64", reflect.TypeOf(v).Elem())
+	if vNum := reflect.ValueOf(ptrElem(v)); isNumberValue(vNum) {
+		return numFloat(vNum), nil
+	}
+	return 0, fmt.Errorf("Can not conver %T value to float64", ptrElem(v))
 }
 
 func init() {
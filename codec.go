@@ -0,0 +1,512 @@
+package geval
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// RuleFormatVersion : Version of serialized rule format, rules of other version are rejected when loading
+const RuleFormatVersion = 1
+
+// ruleMagic : Head of binary serialized rule
+const ruleMagic = "GEVL"
+
+var tokenByName map[string]token.Token
+
+// ruleImage : Serialized form of rule node. Ast is stored with position offsets,
+// so rule can be rebuilt without parsing and positions still point to the source
+type ruleImage struct {
+	Version  int        `json:"version"`
+	Checksum string     `json:"checksum"`
+	Name     string     `json:"name,omitempty"`
+	File     string     `json:"file,omitempty"`
+	Source   string     `json:"source"`
+	Body     *astRecord `json:"ast"`
+}
+
+// astRecord : One ast node, meaning of Pos items and Children depend on Type
+type astRecord struct {
+	Type     string       `json:"t"`
+	Tok      string       `json:"k,omitempty"`
+	Value    string       `json:"v,omitempty"`
+	Pos      []int        `json:"p,omitempty"`
+	Children []*astRecord `json:"c,omitempty"`
+}
+
+// nilRecord : Placeholder of optional child which is nil
+var nilRecord = &astRecord{Type: "nil"}
+
+// MarshalBinary : Serialize compiled rule to binary form, head is magic, format version and sha256 of source
+func (ruleNode *RuleNode) MarshalBinary() ([]byte, error) {
+	image, err := ruleNode.image()
+	if nil != err {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(ruleMagic)
+	binary.Write(buf, binary.BigEndian, uint16(RuleFormatVersion))
+	sum := sha256.Sum256([]byte(ruleNode.src))
+	buf.Write(sum[:])
+	err = gob.NewEncoder(buf).Encode(image)
+	return buf.Bytes(), err
+}
+
+// UnmarshalBinary : Load rule serialized by MarshalBinary without parsing the source.
+// FunContext is not serialized, use LoadRuleNode to load rule with FunContext
+func (ruleNode *RuleNode) UnmarshalBinary(data []byte) error {
+	headLen := len(ruleMagic) + 2 + sha256.Size
+	if len(data) < headLen || ruleMagic != string(data[:len(ruleMagic)]) {
+		return errors.New("Invalid rule data, magic not match")
+	}
+	version := binary.BigEndian.Uint16(data[len(ruleMagic):])
+	if RuleFormatVersion != version {
+		return fmt.Errorf("Rule format version not support: %d, expect: %d", version, RuleFormatVersion)
+	}
+
+	image := &ruleImage{}
+	if err := gob.NewDecoder(bytes.NewReader(data[headLen:])).Decode(image); nil != err {
+		return fmt.Errorf("Decode rule error: %v", err)
+	}
+	image.Checksum = hex.EncodeToString(data[len(ruleMagic)+2 : headLen])
+	return ruleNode.load(image)
+}
+
+// MarshalJSON : Serialize compiled rule to json form
+func (ruleNode *RuleNode) MarshalJSON() ([]byte, error) {
+	image, err := ruleNode.image()
+	if nil != err {
+		return nil, err
+	}
+	return json.Marshal(image)
+}
+
+// UnmarshalJSON : Load rule serialized by MarshalJSON without parsing the source
+func (ruleNode *RuleNode) UnmarshalJSON(data []byte) error {
+	image := &ruleImage{}
+	if err := json.Unmarshal(data, image); nil != err {
+		return fmt.Errorf("Decode rule error: %v", err)
+	}
+	if RuleFormatVersion != image.Version {
+		return fmt.Errorf("Rule format version not support: %d, expect: %d", image.Version, RuleFormatVersion)
+	}
+	return ruleNode.load(image)
+}
+
+// LoadRuleNode : Load rule serialized by MarshalBinary or MarshalJSON, and check it with funcCtx
+func LoadRuleNode(data []byte, funcCtx *FunContext) (*RuleNode, error) {
+	ruleNode := &RuleNode{}
+	var err error
+	if len(data) > 0 && '{' == data[0] {
+		err = ruleNode.UnmarshalJSON(data)
+	} else {
+		err = ruleNode.UnmarshalBinary(data)
+	}
+	if nil != err {
+		return nil, err
+	}
+
+	ruleNode.funcCtx = funcCtx
+	if err = ruleNode.checkPackageCollision(); nil != err {
+		return nil, err
+	}
+	return ruleNode, nil
+}
+
+// Checksum : Hex sha256 of rule source, rules with same checksum are built from the same text
+func (ruleNode *RuleNode) Checksum() string {
+	sum := sha256.Sum256([]byte(ruleNode.src))
+	return hex.EncodeToString(sum[:])
+}
+
+func (ruleNode *RuleNode) image() (*ruleImage, error) {
+	if nil == ruleNode.astFile {
+		return nil, errors.New("Rule is not compiled")
+	}
+	encoder := &astEncoder{base: ruleNode.fset.File(ruleNode.astFile.Pos()).Base()}
+	body, err := encoder.encode(ruleNode.astFile.Decls[0].(*ast.FuncDecl).Body)
+	if nil != err {
+		return nil, err
+	}
+	return &ruleImage{
+		Version:  RuleFormatVersion,
+		Checksum: ruleNode.Checksum(),
+		Name:     ruleNode.name,
+		File:     ruleNode.file,
+		Source:   ruleNode.src,
+		Body:     body,
+	}, nil
+}
+
+func (ruleNode *RuleNode) load(image *ruleImage) error {
+	if image.Checksum != fmt.Sprintf("%x", sha256.Sum256([]byte(image.Source))) {
+		return errors.New("Rule checksum not match, data may be corrupted")
+	}
+
+	fset := token.NewFileSet()
+	fileName := image.File
+	if "" == fileName {
+		fileName = image.Name
+	}
+	file := fset.AddFile(fileName, -1, len(image.Source))
+	file.SetLinesForContent([]byte(image.Source))
+	decoder := &astDecoder{file: file}
+	body, err := decoder.decode(image.Body)
+	if nil != err {
+		return err
+	}
+	block, ok := body.(*ast.BlockStmt)
+	if !ok {
+		return fmt.Errorf("Rule body should be block, not %T", body)
+	}
+
+	*ruleNode = RuleNode{
+		name: image.Name,
+		file: image.File,
+		src:  image.Source,
+		fset: fset,
+		astFile: &ast.File{
+			Package: file.Pos(0),
+			Name:    ast.NewIdent("main"),
+			Decls: []ast.Decl{&ast.FuncDecl{
+				Name: ast.NewIdent("main"),
+				Type: &ast.FuncType{Params: &ast.FieldList{}},
+				Body: block,
+			}},
+		},
+	}
+	return nil
+}
+
+// astEncoder : Convert ast to records, positions are stored as offset
+type astEncoder struct {
+	base int
+	// noPos drop all positions, used for canonical hash
+	noPos bool
+}
+
+func (e *astEncoder) pos(list ...token.Pos) []int {
+	if e.noPos {
+		return nil
+	}
+	offsets := make([]int, len(list))
+	for i, pos := range list {
+		offsets[i] = -1
+		if pos.IsValid() {
+			offsets[i] = int(pos) - e.base
+		}
+	}
+	return offsets
+}
+
+func (e *astEncoder) encodeList(record *astRecord, nodes ...ast.Node) (*astRecord, error) {
+	for _, node := range nodes {
+		child, err := e.encode(node)
+		if nil != err {
+			return nil, err
+		}
+		record.Children = append(record.Children, child)
+	}
+	return record, nil
+}
+
+func (e *astEncoder) encode(node ast.Node) (*astRecord, error) {
+	switch n := node.(type) {
+	case nil:
+		return nilRecord, nil
+	case *ast.BlockStmt:
+		if nil == n {
+			return nilRecord, nil
+		}
+		record := &astRecord{Type: "Block", Pos: e.pos(n.Lbrace, n.Rbrace)}
+		for _, stmt := range n.List {
+			if _, err := e.encodeList(record, stmt); nil != err {
+				return nil, err
+			}
+		}
+		return record, nil
+	case *ast.ExprStmt:
+		return e.encodeList(&astRecord{Type: "ExprStmt"}, n.X)
+	case *ast.AssignStmt:
+		record := &astRecord{Type: "Assign", Tok: n.Tok.String(), Pos: e.pos(n.TokPos), Value: fmt.Sprint(len(n.Lhs))}
+		for _, expr := range append(append([]ast.Expr{}, n.Lhs...), n.Rhs...) {
+			if _, err := e.encodeList(record, expr); nil != err {
+				return nil, err
+			}
+		}
+		return record, nil
+	case *ast.IncDecStmt:
+		return e.encodeList(&astRecord{Type: "IncDec", Tok: n.Tok.String(), Pos: e.pos(n.TokPos)}, n.X)
+	case *ast.BranchStmt:
+		if nil != n.Label {
+			return nil, errors.New("Branch label not support")
+		}
+		return &astRecord{Type: "Branch", Tok: n.Tok.String(), Pos: e.pos(n.TokPos)}, nil
+	case *ast.IfStmt:
+		return e.encodeList(&astRecord{Type: "If", Pos: e.pos(n.If)}, optStmt(n.Init), optExpr(n.Cond), n.Body, optStmt(n.Else))
+	case *ast.ForStmt:
+		return e.encodeList(&astRecord{Type: "For", Pos: e.pos(n.For)}, optStmt(n.Init), optExpr(n.Cond), optStmt(n.Post), n.Body)
+	case *ast.RangeStmt:
+		record := &astRecord{Type: "Range", Tok: n.Tok.String(), Pos: e.pos(n.For, n.TokPos, n.Range)}
+		return e.encodeList(record, optExpr(n.Key), optExpr(n.Value), n.X, n.Body)
+	case *ast.Ident:
+		return &astRecord{Type: "Ident", Value: n.Name, Pos: e.pos(n.NamePos)}, nil
+	case *ast.BasicLit:
+		return &astRecord{Type: "Lit", Tok: n.Kind.String(), Value: n.Value, Pos: e.pos(n.ValuePos)}, nil
+	case *ast.BinaryExpr:
+		return e.encodeList(&astRecord{Type: "Binary", Tok: n.Op.String(), Pos: e.pos(n.OpPos)}, n.X, n.Y)
+	case *ast.UnaryExpr:
+		return e.encodeList(&astRecord{Type: "Unary", Tok: n.Op.String(), Pos: e.pos(n.OpPos)}, n.X)
+	case *ast.ParenExpr:
+		return e.encodeList(&astRecord{Type: "Paren", Pos: e.pos(n.Lparen, n.Rparen)}, n.X)
+	case *ast.CallExpr:
+		record := &astRecord{Type: "Call", Pos: e.pos(n.Lparen, n.Ellipsis, n.Rparen)}
+		if _, err := e.encodeList(record, n.Fun); nil != err {
+			return nil, err
+		}
+		for _, arg := range n.Args {
+			if _, err := e.encodeList(record, arg); nil != err {
+				return nil, err
+			}
+		}
+		return record, nil
+	case *ast.SelectorExpr:
+		return e.encodeList(&astRecord{Type: "Selector"}, n.X, n.Sel)
+	case *ast.IndexExpr:
+		return e.encodeList(&astRecord{Type: "Index", Pos: e.pos(n.Lbrack, n.Rbrack)}, n.X, n.Index)
+	case *ast.SliceExpr:
+		record := &astRecord{Type: "Slice", Value: fmt.Sprint(n.Slice3), Pos: e.pos(n.Lbrack, n.Rbrack)}
+		return e.encodeList(record, n.X, optExpr(n.Low), optExpr(n.High), optExpr(n.Max))
+	case *ast.CompositeLit:
+		record := &astRecord{Type: "Composite", Pos: e.pos(n.Lbrace, n.Rbrace)}
+		if _, err := e.encodeList(record, optExpr(n.Type)); nil != err {
+			return nil, err
+		}
+		for _, elt := range n.Elts {
+			if _, err := e.encodeList(record, elt); nil != err {
+				return nil, err
+			}
+		}
+		return record, nil
+	case *ast.KeyValueExpr:
+		return e.encodeList(&astRecord{Type: "KeyValue", Pos: e.pos(n.Colon)}, n.Key, n.Value)
+	case *ast.ArrayType:
+		return e.encodeList(&astRecord{Type: "Array", Pos: e.pos(n.Lbrack)}, optExpr(n.Len), n.Elt)
+	case *ast.MapType:
+		return e.encodeList(&astRecord{Type: "Map", Pos: e.pos(n.Map)}, n.Key, n.Value)
+	case *ast.ReturnStmt:
+		record := &astRecord{Type: "Return", Pos: e.pos(n.Return)}
+		for _, expr := range n.Results {
+			if _, err := e.encodeList(record, expr); nil != err {
+				return nil, err
+			}
+		}
+		return record, nil
+	}
+	return nil, fmt.Errorf("Node type not support to serialize: %T", node)
+}
+
+// optStmt : Keep nil of optional statement as untyped nil, so encoder can tell it
+func optStmt(stmt ast.Stmt) ast.Node {
+	if nil == stmt {
+		return nil
+	}
+	return stmt
+}
+
+func optExpr(expr ast.Expr) ast.Node {
+	if nil == expr {
+		return nil
+	}
+	return expr
+}
+
+// astDecoder : Rebuild ast from records
+type astDecoder struct {
+	file *token.File
+}
+
+func (d *astDecoder) pos(record *astRecord, i int) token.Pos {
+	if i >= len(record.Pos) || record.Pos[i] < 0 || record.Pos[i] > d.file.Size() {
+		return token.NoPos
+	}
+	return d.file.Pos(record.Pos[i])
+}
+
+func (d *astDecoder) tok(record *astRecord) (token.Token, error) {
+	tok, ok := tokenByName[record.Tok]
+	if !ok {
+		return token.ILLEGAL, fmt.Errorf("Unknown token: %s", record.Tok)
+	}
+	return tok, nil
+}
+
+func (d *astDecoder) children(record *astRecord, num int) ([]ast.Node, error) {
+	if len(record.Children) < num {
+		return nil, fmt.Errorf("Node %s expect %d children, real: %d", record.Type, num, len(record.Children))
+	}
+	nodes := make([]ast.Node, len(record.Children))
+	for i, child := range record.Children {
+		node, err := d.decode(child)
+		if nil != err {
+			return nil, err
+		}
+		nodes[i] = node
+	}
+	return nodes, nil
+}
+
+func (d *astDecoder) decode(record *astRecord) (node ast.Node, err error) {
+	if nil == record {
+		return nil, errors.New("Missing ast record")
+	}
+	defer func() {
+		// child of unexpect type make type assertion fail
+		if r := recover(); nil != r {
+			err = fmt.Errorf("Invalid ast record %s: %v", record.Type, r)
+		}
+	}()
+
+	switch record.Type {
+	case "nil":
+		return nil, nil
+	case "Ident":
+		return &ast.Ident{Name: record.Value, NamePos: d.pos(record, 0)}, nil
+	case "Branch", "Lit":
+		tok, err := d.tok(record)
+		if nil != err {
+			return nil, err
+		}
+		if "Lit" == record.Type {
+			return &ast.BasicLit{Kind: tok, Value: record.Value, ValuePos: d.pos(record, 0)}, nil
+		}
+		return &ast.BranchStmt{Tok: tok, TokPos: d.pos(record, 0)}, nil
+	}
+
+	nodes, err := d.children(record, 0)
+	if nil != err {
+		return nil, err
+	}
+	switch record.Type {
+	case "Block":
+		block := &ast.BlockStmt{Lbrace: d.pos(record, 0), Rbrace: d.pos(record, 1)}
+		for _, n := range nodes {
+			block.List = append(block.List, n.(ast.Stmt))
+		}
+		return block, nil
+	case "ExprStmt":
+		return &ast.ExprStmt{X: nodes[0].(ast.Expr)}, nil
+	case "Assign":
+		tok, err := d.tok(record)
+		if nil != err {
+			return nil, err
+		}
+		lhsNum := 0
+		fmt.Sscan(record.Value, &lhsNum)
+		assign := &ast.AssignStmt{Tok: tok, TokPos: d.pos(record, 0)}
+		for i, n := range nodes {
+			if i < lhsNum {
+				assign.Lhs = append(assign.Lhs, n.(ast.Expr))
+			} else {
+				assign.Rhs = append(assign.Rhs, n.(ast.Expr))
+			}
+		}
+		return assign, nil
+	case "IncDec":
+		tok, err := d.tok(record)
+		if nil != err {
+			return nil, err
+		}
+		return &ast.IncDecStmt{Tok: tok, TokPos: d.pos(record, 0), X: nodes[0].(ast.Expr)}, nil
+	case "If":
+		ifStmt := &ast.IfStmt{If: d.pos(record, 0), Body: nodes[2].(*ast.BlockStmt)}
+		ifStmt.Init, _ = nodes[0].(ast.Stmt)
+		ifStmt.Cond, _ = nodes[1].(ast.Expr)
+		ifStmt.Else, _ = nodes[3].(ast.Stmt)
+		return ifStmt, nil
+	case "For":
+		forStmt := &ast.ForStmt{For: d.pos(record, 0), Body: nodes[3].(*ast.BlockStmt)}
+		forStmt.Init, _ = nodes[0].(ast.Stmt)
+		forStmt.Cond, _ = nodes[1].(ast.Expr)
+		forStmt.Post, _ = nodes[2].(ast.Stmt)
+		return forStmt, nil
+	case "Range":
+		tok, err := d.tok(record)
+		if nil != err {
+			return nil, err
+		}
+		rangeStmt := &ast.RangeStmt{For: d.pos(record, 0), TokPos: d.pos(record, 1), Tok: tok, Range: d.pos(record, 2)}
+		rangeStmt.Key, _ = nodes[0].(ast.Expr)
+		rangeStmt.Value, _ = nodes[1].(ast.Expr)
+		rangeStmt.X = nodes[2].(ast.Expr)
+		rangeStmt.Body = nodes[3].(*ast.BlockStmt)
+		return rangeStmt, nil
+	case "Binary":
+		tok, err := d.tok(record)
+		if nil != err {
+			return nil, err
+		}
+		return &ast.BinaryExpr{Op: tok, OpPos: d.pos(record, 0), X: nodes[0].(ast.Expr), Y: nodes[1].(ast.Expr)}, nil
+	case "Unary":
+		tok, err := d.tok(record)
+		if nil != err {
+			return nil, err
+		}
+		return &ast.UnaryExpr{Op: tok, OpPos: d.pos(record, 0), X: nodes[0].(ast.Expr)}, nil
+	case "Paren":
+		return &ast.ParenExpr{Lparen: d.pos(record, 0), Rparen: d.pos(record, 1), X: nodes[0].(ast.Expr)}, nil
+	case "Call":
+		call := &ast.CallExpr{Lparen: d.pos(record, 0), Ellipsis: d.pos(record, 1), Rparen: d.pos(record, 2), Fun: nodes[0].(ast.Expr)}
+		for _, n := range nodes[1:] {
+			call.Args = append(call.Args, n.(ast.Expr))
+		}
+		return call, nil
+	case "Selector":
+		return &ast.SelectorExpr{X: nodes[0].(ast.Expr), Sel: nodes[1].(*ast.Ident)}, nil
+	case "Index":
+		return &ast.IndexExpr{Lbrack: d.pos(record, 0), Rbrack: d.pos(record, 1), X: nodes[0].(ast.Expr), Index: nodes[1].(ast.Expr)}, nil
+	case "Slice":
+		slice := &ast.SliceExpr{Lbrack: d.pos(record, 0), Rbrack: d.pos(record, 1), X: nodes[0].(ast.Expr), Slice3: "true" == record.Value}
+		slice.Low, _ = nodes[1].(ast.Expr)
+		slice.High, _ = nodes[2].(ast.Expr)
+		slice.Max, _ = nodes[3].(ast.Expr)
+		return slice, nil
+	case "Composite":
+		lit := &ast.CompositeLit{Lbrace: d.pos(record, 0), Rbrace: d.pos(record, 1)}
+		lit.Type, _ = nodes[0].(ast.Expr)
+		for _, n := range nodes[1:] {
+			lit.Elts = append(lit.Elts, n.(ast.Expr))
+		}
+		return lit, nil
+	case "KeyValue":
+		return &ast.KeyValueExpr{Colon: d.pos(record, 0), Key: nodes[0].(ast.Expr), Value: nodes[1].(ast.Expr)}, nil
+	case "Array":
+		array := &ast.ArrayType{Lbrack: d.pos(record, 0), Elt: nodes[1].(ast.Expr)}
+		array.Len, _ = nodes[0].(ast.Expr)
+		return array, nil
+	case "Map":
+		return &ast.MapType{Map: d.pos(record, 0), Key: nodes[0].(ast.Expr), Value: nodes[1].(ast.Expr)}, nil
+	case "Return":
+		ret := &ast.ReturnStmt{Return: d.pos(record, 0)}
+		for _, n := range nodes {
+			ret.Results = append(ret.Results, n.(ast.Expr))
+		}
+		return ret, nil
+	}
+	return nil, fmt.Errorf("Unknown ast record type: %s", record.Type)
+}
+
+func init() {
+	tokenByName = make(map[string]token.Token)
+	for tok := token.ILLEGAL; tok <= token.VAR; tok++ {
+		tokenByName[tok.String()] = tok
+	}
+}
@@ -0,0 +1,188 @@
+package geval
+
+import (
+	"fmt"
+	"go/token"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// Comparable : User type compared with other value of rule. Compare returns negative if the value is
+// less than other, 0 if they are equal and positive if it is greater. It is used by all compare operators
+type Comparable interface {
+	Compare(other interface{}) (int, error)
+}
+
+// Lesser : User type with order, `a < b` is `a.Less(b)`. Both sides of order operators should be Lesser,
+// `==` and `!=` are checked like other values
+type Lesser interface {
+	Less(other interface{}) bool
+}
+
+// compare : Compare values like Go. Numbers of different types are compared by value, strings are compared
+// lexically, time.Time are compared by instant, pointers are equal if they point to the same data and
+// other values are equal if they are deeply equal
+func compare(a, b interface{}, op token.Token) (bool, error) {
+	if c, ok := asComparable(a); ok {
+		r, err := c.Compare(ptrElem(b))
+		return cmpResult(r, op), err
+	}
+	if c, ok := asComparable(b); ok {
+		r, err := c.Compare(ptrElem(a))
+		return cmpResult(-r, op), err
+	}
+
+	isEqualOp := token.EQL == op || token.NEQ == op
+	if !isEqualOp {
+		la, okA := asLesser(a)
+		lb, okB := asLesser(b)
+		if okA && okB {
+			r := 0
+			if la.Less(ptrElem(b)) {
+				r = -1
+			} else if lb.Less(ptrElem(a)) {
+				r = 1
+			}
+			return cmpResult(r, op), nil
+		}
+	}
+
+	a, b = ptrElem(a), ptrElem(b)
+	if r, ok := cmpTime(a, b); ok {
+		return cmpResult(r, op), nil
+	}
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch {
+	case isNumberValue(va) && isNumberValue(vb):
+		if isNaNValue(va) || isNaNValue(vb) {
+			// NaN is not equal to anything, even itself, and not ordered
+			return token.NEQ == op, nil
+		}
+		return cmpResult(cmpNumber(va, vb), op), nil
+	case isStringValue(va) && isStringValue(vb):
+		return cmpResult(strings.Compare(va.String(), vb.String()), op), nil
+	case !isEqualOp:
+		return false, fmt.Errorf("Operator %s not defined on %T and %T", op, a, b)
+	}
+
+	var equal bool
+	switch {
+	case !va.IsValid() || !vb.IsValid():
+		equal = isNilValue(va) && isNilValue(vb)
+	case reflect.Ptr == va.Kind() && reflect.Ptr == vb.Kind():
+		equal = va.Pointer() == vb.Pointer() && va.Type() == vb.Type()
+	default:
+		equal = reflect.DeepEqual(a, b)
+	}
+	return equal == (token.EQL == op), nil
+}
+
+func cmpResult(r int, op token.Token) bool {
+	switch op {
+	case token.EQL:
+		return 0 == r
+	case token.NEQ:
+		return 0 != r
+	case token.LSS:
+		return r < 0
+	case token.LEQ:
+		return r <= 0
+	case token.GTR:
+		return r > 0
+	case token.GEQ:
+		return r >= 0
+	}
+	return false
+}
+
+// cmpNumber : Compare numbers without losing precision of large integers
+func cmpNumber(va reflect.Value, vb reflect.Value) int {
+	ka, kb := numClass(va.Kind()), numClass(vb.Kind())
+	switch {
+	case 'i' == ka && 'i' == kb:
+		return cmpOrdered(va.Int() < vb.Int(), va.Int() > vb.Int())
+	case 'u' == ka && 'u' == kb:
+		return cmpOrdered(va.Uint() < vb.Uint(), va.Uint() > vb.Uint())
+	case 'i' == ka && 'u' == kb:
+		if va.Int() < 0 {
+			return -1
+		}
+		return cmpOrdered(uint64(va.Int()) < vb.Uint(), uint64(va.Int()) > vb.Uint())
+	case 'u' == ka && 'i' == kb:
+		return -cmpNumber(vb, va)
+	}
+	fa, fb := numFloat(va), numFloat(vb)
+	return cmpOrdered(fa < fb, fa > fb)
+}
+
+func cmpOrdered(less bool, greater bool) int {
+	if less {
+		return -1
+	} else if greater {
+		return 1
+	}
+	return 0
+}
+
+// numClass : `i` for signed integer, `u` for unsigned integer and `f` for float
+func numClass(kind reflect.Kind) byte {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return 'i'
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return 'u'
+	}
+	return 'f'
+}
+
+func numFloat(v reflect.Value) float64 {
+	switch numClass(v.Kind()) {
+	case 'i':
+		return float64(v.Int())
+	case 'u':
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
+
+func isNumberValue(v reflect.Value) bool {
+	return v.IsValid() && IsNumber(v.Kind())
+}
+
+func isNaNValue(v reflect.Value) bool {
+	return 'f' == numClass(v.Kind()) && math.IsNaN(v.Float())
+}
+
+func isStringValue(v reflect.Value) bool {
+	return v.IsValid() && reflect.String == v.Kind()
+}
+
+// isNilValue : Check if value is nil or nil of ptr, map, slice, func, chan and interface
+func isNilValue(v reflect.Value) bool {
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+// asComparable : Method may be defined on ptr receiver, so bound data is checked before its value
+func asComparable(v interface{}) (Comparable, bool) {
+	if c, ok := v.(Comparable); ok {
+		return c, true
+	}
+	c, ok := ptrElem(v).(Comparable)
+	return c, ok
+}
+
+func asLesser(v interface{}) (Lesser, bool) {
+	if l, ok := v.(Lesser); ok {
+		return l, true
+	}
+	l, ok := ptrElem(v).(Lesser)
+	return l, ok
+}
@@ -1,34 +1,63 @@
 package geval
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
 	"strconv"
+	"time"
 )
 
 var typeInterface reflect.Type
 var typeMapStrInterface reflect.Type
+var typeDataCtx = reflect.TypeOf((*DataContext)(nil))
 
 // DataContext : DataContext is used to store temp data or bind data
 type DataContext struct {
-	data map[string]interface{}
+	data     map[string]interface{}
+	readOnly map[string]bool
+	// aliases map variable to the read only variable it share memory with, like `m` of `m := headers`
+	aliases  map[string]string
+	lazy     map[string]func() (interface{}, error)
+	resolver func(name string) (interface{}, bool, error)
+	// memo keep lazy and resolved variables during one Eval
+	memo   map[string]interface{}
+	clock  func() time.Time
+	parent *DataContext
+	// isolated child copy variables of parent on first write, so the parent is never changed by rules
+	isolated bool
 }
 
 // FunContext : FuncContext is used to store function that should inject into eval engine
 type FunContext struct {
-	data map[string]interface{}
+	data   map[string]interface{}
+	pkgs   map[string]map[string]interface{}
+	parent *FunContext
 }
 
-// NewFunCtx : Get a new instance of FunContext, buildin function `make` and `len` is injected
+// ctxFunc : Function bound by BindWithContext, DataContext of the running rule is passed as the first param
+type ctxFunc struct {
+	fun interface{}
+}
+
+// NewFunCtx : Get a new instance of FunContext, buildin function `make` and `len` are injected.
+// Call BindTimePackage to use `now` and package `time`
 func NewFunCtx() *FunContext {
-	ctx := &FunContext{data: make(map[string]interface{})}
+	ctx := &FunContext{data: make(map[string]interface{}), pkgs: make(map[string]map[string]interface{})}
+	ctx.bindBuildIn()
+	return ctx
+}
+
+// NewChildFunCtx : Get a FunContext overlay on parent, functions bound to the child shadow the parent's
+func NewChildFunCtx(parent *FunContext) *FunContext {
+	ctx := &FunContext{data: make(map[string]interface{}), pkgs: make(map[string]map[string]interface{}), parent: parent}
+	return ctx
+}
 
-	// Bind build in function
+func (ctx *FunContext) bindBuildIn() {
 	ctx.data["make"] = buildInMake
 	ctx.data["len"] = buildInLen
-
-	return ctx
 }
 
 // Bind : Inject self define function into eval engine
@@ -36,41 +65,477 @@ func (ctx *FunContext) Bind(name string, fun interface{}) error {
 	if _, ok := ctx.data[name]; ok {
 		return fmt.Errorf("Func '%s' have bind before", name)
 	}
+	return ctx.Rebind(name, fun)
+}
+
+// BindWithContext : Inject function whose first param is *DataContext, rules call it without that param
+// and it gets DataContext of the running rule
+func (ctx *FunContext) BindWithContext(name string, fun interface{}) error {
+	tFunc := reflect.TypeOf(fun)
+	if nil == tFunc || reflect.Func != tFunc.Kind() || 0 == tFunc.NumIn() || typeDataCtx != tFunc.In(0) {
+		return fmt.Errorf("Func '%s' should take *DataContext as the first param", name)
+	}
+	return ctx.Bind(name, ctxFunc{fun})
+}
+
+// Rebind : Inject self define function into eval engine, replace the function bound before
+func (ctx *FunContext) Rebind(name string, fun interface{}) error {
+	if _, ok := ctx.pkgs[name]; ok {
+		return fmt.Errorf("Func '%s' collides with package '%s'", name, name)
+	}
 	ctx.data[name] = fun
 	return nil
 }
 
+// Unbind : Remove a function or package from this context, parent context is not touched
+func (ctx *FunContext) Unbind(name string) error {
+	_, isFunc := ctx.data[name]
+	_, isPkg := ctx.pkgs[name]
+	if !isFunc && !isPkg {
+		return fmt.Errorf("Func '%s' not bind", name)
+	}
+	delete(ctx.data, name)
+	delete(ctx.pkgs, name)
+	return nil
+}
+
+// Reset : Remove all functions and packages of this context, buildin functions are kept, package `time`
+// should be bound again by BindTimePackage
+func (ctx *FunContext) Reset() {
+	ctx.data = make(map[string]interface{})
+	ctx.pkgs = make(map[string]map[string]interface{})
+	if nil == ctx.parent {
+		ctx.bindBuildIn()
+	}
+}
+
+// BindPackage : Inject a namespace of functions, rules call them as `name.Func(...)`.
+// pkg can be a map[string]interface{} of functions, or a struct (or ptr to struct) whose
+// exported func fields and exported methods become the package members. Binding data variable
+// with the same name is reported when a rule use the package
+func (ctx *FunContext) BindPackage(name string, pkg interface{}) error {
+	if _, ok := ctx.pkgs[name]; ok {
+		return fmt.Errorf("Package '%s' have bind before", name)
+	}
+	if _, ok := ctx.data[name]; ok {
+		return fmt.Errorf("Package '%s' collides with func '%s'", name, name)
+	}
+
+	members, err := packageMembers(pkg)
+	if nil != err {
+		return fmt.Errorf("Bind package '%s' fail: %v", name, err)
+	}
+	ctx.pkgs[name] = members
+	return nil
+}
+
+// lookup : Find function by name, walk up to parent if not found
+func (ctx *FunContext) lookup(name string) (interface{}, bool) {
+	for c := ctx; nil != c; c = c.parent {
+		if fun, ok := c.data[name]; ok {
+			return fun, true
+		}
+		if _, ok := c.pkgs[name]; ok {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+func (ctx *FunContext) getPackage(name string) (map[string]interface{}, bool) {
+	for c := ctx; nil != c; c = c.parent {
+		if pkg, ok := c.pkgs[name]; ok {
+			return pkg, true
+		}
+		if _, ok := c.data[name]; ok {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+func (ctx *FunContext) hasPackage() bool {
+	for c := ctx; nil != c; c = c.parent {
+		if len(c.pkgs) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func packageMembers(pkg interface{}) (members map[string]interface{}, err error) {
+	members = make(map[string]interface{})
+	if m, ok := pkg.(map[string]interface{}); ok {
+		for name, fun := range m {
+			if nil == fun || reflect.Func != reflect.TypeOf(fun).Kind() {
+				return nil, fmt.Errorf("Member '%s' is not func", name)
+			}
+			members[name] = fun
+		}
+		return
+	}
+
+	vPkg := reflect.ValueOf(pkg)
+	if !vPkg.IsValid() {
+		return nil, errors.New("Package is nil")
+	}
+	for i := 0; i < vPkg.NumMethod(); i++ {
+		members[vPkg.Type().Method(i).Name] = vPkg.Method(i).Interface()
+	}
+
+	vStruct := reflect.Indirect(vPkg)
+	if reflect.Struct != vStruct.Kind() {
+		return nil, fmt.Errorf("Package must be map[string]interface{} or struct, not %v", vPkg.Type())
+	}
+	tStruct := vStruct.Type()
+	for i := 0; i < tStruct.NumField(); i++ {
+		field := tStruct.Field(i)
+		if "" != field.PkgPath || reflect.Func != field.Type.Kind() || vStruct.Field(i).IsNil() {
+			continue
+		}
+		members[field.Name] = vStruct.Field(i).Interface()
+	}
+	return
+}
+
 // NewDataCtx : Get a new instance of DataContext
 func NewDataCtx() *DataContext {
-	ctx := &DataContext{data: make(map[string]interface{})}
+	return newDataCtx(nil)
+}
+
+// NewChildDataCtx : Get a DataContext overlay on parent. Variables of the child shadow the parent's,
+// new and temporary variables are written to the child. Variables of parent are copied into the child
+// on the first write, containers are deep copied, so writes of rules never reach the parent.
+// Methods and functions called by rules may still change the data they get
+func NewChildDataCtx(parent *DataContext) *DataContext {
+	ctx := newDataCtx(parent)
+	ctx.isolated = true
+	return ctx
+}
+
+func newDataCtx(parent *DataContext) *DataContext {
+	ctx := &DataContext{
+		data:     make(map[string]interface{}),
+		readOnly: make(map[string]bool),
+		lazy:     make(map[string]func() (interface{}, error)),
+		parent:   parent,
+	}
 	return ctx
 }
 
 // Bind : Inject variable into datacontext, data must be ptr that it's value can be update in eval engine
 func (ctx *DataContext) Bind(name string, data interface{}) error {
+	if ctx.isBound(name) {
+		return fmt.Errorf("Variable '%s' have bind before", name)
+	}
+	return ctx.Rebind(name, data)
+}
+
+// Rebind : Inject variable into datacontext, replace the variable bound before
+func (ctx *DataContext) Rebind(name string, data interface{}) error {
 	v := reflect.ValueOf(data)
 	if v.Kind() != reflect.Ptr {
 		return errors.New("Must set ptr")
 	}
-	if _, ok := ctx.data[name]; ok {
+	ctx.data[name] = data
+	delete(ctx.readOnly, name)
+	delete(ctx.lazy, name)
+	delete(ctx.aliases, name)
+	return nil
+}
+
+// BindReadOnly : Inject variable that rules can read but not assign, data must be ptr. Variables assigned
+// from it that share its memory, like `m := config`, can not be written by index or selector either
+func (ctx *DataContext) BindReadOnly(name string, data interface{}) error {
+	err := ctx.Bind(name, data)
+	if nil != err {
+		return err
+	}
+	ctx.readOnly[name] = true
+	return nil
+}
+
+// BindValue : Inject a deep copy of value as read only variable, value need not to be ptr
+func (ctx *DataContext) BindValue(name string, value interface{}) error {
+	if nil == value {
+		return fmt.Errorf("Can not bind nil value to '%s'", name)
+	}
+	value = deepCopy(reflect.ValueOf(value), make(map[uintptr]reflect.Value)).Interface()
+	return ctx.BindReadOnly(name, valuePtr(value))
+}
+
+// BindJSON : Decode json and bind it. Objects are map[string]interface{}, arrays are []interface{}
+// and numbers are float64, keys of object can be read as `data.key`
+func (ctx *DataContext) BindJSON(name string, data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); nil != err {
+		return err
+	}
+	return ctx.Bind(name, &value)
+}
+
+// BindLazy : Inject read only variable computed by fun on first access, the result is kept until the next Eval
+func (ctx *DataContext) BindLazy(name string, fun func() (interface{}, error)) error {
+	if ctx.isBound(name) {
 		return fmt.Errorf("Variable '%s' have bind before", name)
 	}
-	ctx.data[name] = data
+	if nil == fun {
+		return fmt.Errorf("Can not bind nil func to '%s'", name)
+	}
+	ctx.lazy[name] = fun
+	return nil
+}
+
+// SetResolver : Set hook to fetch unknown variable on demand. resolver return found = false if it do not know the
+// variable either. Resolved variables are read only and kept until the next Eval
+func (ctx *DataContext) SetResolver(resolver func(name string) (value interface{}, found bool, err error)) {
+	ctx.resolver = resolver
+}
+
+// Unbind : Remove a variable from this context, parent context is not touched
+func (ctx *DataContext) Unbind(name string) error {
+	if !ctx.isBound(name) {
+		return fmt.Errorf("Variable '%s' not bind", name)
+	}
+	delete(ctx.data, name)
+	delete(ctx.readOnly, name)
+	delete(ctx.lazy, name)
+	delete(ctx.memo, name)
+	delete(ctx.aliases, name)
 	return nil
 }
 
+// Reset : Remove all bind and temporary variables of this context, so it can be reused
+func (ctx *DataContext) Reset() {
+	ctx.data = make(map[string]interface{})
+	ctx.readOnly = make(map[string]bool)
+	ctx.lazy = make(map[string]func() (interface{}, error))
+	ctx.resolver = nil
+	ctx.memo = nil
+	ctx.aliases = nil
+}
+
+// Clone : Deep copy context and its parents. Bound data are copied, so writes to the clone do not
+// change the caller's data. Lazy variables and resolver are shared, values they return are not copied
+func (ctx *DataContext) Clone() *DataContext {
+	return ctx.clone(make(map[uintptr]reflect.Value))
+}
+
+func (ctx *DataContext) clone(seen map[uintptr]reflect.Value) *DataContext {
+	var parent *DataContext
+	if nil != ctx.parent {
+		parent = ctx.parent.clone(seen)
+	}
+	c := newDataCtx(parent)
+	for name, data := range ctx.data {
+		c.data[name] = deepCopy(reflect.ValueOf(data), seen).Interface()
+	}
+	for name, readOnly := range ctx.readOnly {
+		c.readOnly[name] = readOnly
+	}
+	for name, lazy := range ctx.lazy {
+		c.lazy[name] = lazy
+	}
+	for name, source := range ctx.aliases {
+		c.setAlias(name, source)
+	}
+	c.resolver = ctx.resolver
+	c.clock = ctx.clock
+	c.isolated = ctx.isolated
+	return c
+}
+
+// SetClock : Set clock used by `now()` and `time.Now()` in rules, so that time can be fixed in test
+func (ctx *DataContext) SetClock(clock func() time.Time) {
+	ctx.clock = clock
+}
+
+// Now : Current time of clock, clock of parent is used if not set, time.Now is the default
+func (ctx *DataContext) Now() time.Time {
+	for c := ctx; nil != c; c = c.parent {
+		if nil != c.clock {
+			return c.clock()
+		}
+	}
+	return time.Now()
+}
+
+// beginEval : Forget lazy and resolved variables computed by last Eval
+func (ctx *DataContext) beginEval() {
+	ctx.memo = nil
+}
+
+// shadow : Copy variable of parent into isolated ctx before it is written, return true if copied
+func (ctx *DataContext) shadow(name string) bool {
+	if !ctx.isolated {
+		return false
+	}
+	data, owner, ok := ctx.lookup(name)
+	if !ok || owner == ctx || owner.readOnly[name] {
+		// read only variable is not copied, so the write is denied
+		return false
+	}
+	ctx.data[name] = deepCopy(reflect.ValueOf(data), make(map[uintptr]reflect.Value)).Interface()
+	return true
+}
+
+func (ctx *DataContext) isBound(name string) bool {
+	_, isData := ctx.data[name]
+	_, isLazy := ctx.lazy[name]
+	return isData || isLazy
+}
+
+// checkWritable : Return permission error if variable is read only
+func (ctx *DataContext) checkWritable(name string) error {
+	_, owner, ok := ctx.lookup(name)
+	if ok && owner.readOnly[name] {
+		return fmt.Errorf("Permission denied, variable '%s' is read only", name)
+	}
+	if !ok && ctx.isComputed(name) {
+		return fmt.Errorf("Permission denied, variable '%s' is computed and read only", name)
+	}
+	return nil
+}
+
+// setAlias : Remember variable share memory with read only variable source, empty source clear it
+func (ctx *DataContext) setAlias(name string, source string) {
+	if "" == source {
+		delete(ctx.aliases, name)
+		return
+	}
+	if nil == ctx.aliases {
+		ctx.aliases = make(map[string]string)
+	}
+	ctx.aliases[name] = source
+}
+
+// aliasOf : Get read only variable that variable share memory with
+func (ctx *DataContext) aliasOf(name string) string {
+	for c := ctx; nil != c; c = c.parent {
+		if source, ok := c.aliases[name]; ok {
+			return source
+		}
+		if _, ok := c.data[name]; ok {
+			break
+		}
+	}
+	return ""
+}
+
+// isComputed : Check if variable come from lazy binding or resolver
+func (ctx *DataContext) isComputed(name string) bool {
+	if _, ok := ctx.memo[name]; ok {
+		return true
+	}
+	for c := ctx; nil != c; c = c.parent {
+		if _, ok := c.lazy[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// compute : Evaluate lazy variable or ask resolver, result is memoized in ctx
+func (ctx *DataContext) compute(name string) (value interface{}, found bool, err error) {
+	if value, found = ctx.memo[name]; found {
+		return
+	}
+
+	for c := ctx; nil != c && !found; c = c.parent {
+		if fun, ok := c.lazy[name]; ok {
+			found = true
+			value, err = fun()
+		}
+	}
+	// resolver of parent is asked only if child neither found nor failed
+	for c := ctx; nil != c && !found && nil == err; c = c.parent {
+		if nil != c.resolver {
+			value, found, err = c.resolver(name)
+		}
+	}
+	if nil != err {
+		return nil, found, fmt.Errorf("Compute variable %s error: %v", name, err)
+	}
+	if !found {
+		return
+	}
+
+	if nil != value {
+		value = valuePtr(value)
+	}
+	if nil == ctx.memo {
+		ctx.memo = make(map[string]interface{})
+	}
+	ctx.memo[name] = value
+	return
+}
+
+// valuePtr : Copy value into a new ptr, so it can be used like bound variable
+func valuePtr(value interface{}) interface{} {
+	vValue := reflect.ValueOf(value)
+	ptr := reflect.New(vValue.Type())
+	ptr.Elem().Set(vValue)
+	return ptr.Interface()
+}
+
+// lookup : Find variable by name, walk up to parent if not found
+func (ctx *DataContext) lookup(name string) (value interface{}, owner *DataContext, ok bool) {
+	for c := ctx; nil != c; c = c.parent {
+		if value, ok = c.data[name]; ok {
+			return value, c, true
+		}
+	}
+	return nil, nil, false
+}
+
 // Get : Get one data from datacontext
 func (ctx *DataContext) Get(name string) (value interface{}, err error) {
-	value, ok := ctx.data[name]
-	if !ok {
+	value, _, ok := ctx.lookup(name)
+	if ok {
+		return
+	}
+
+	value, ok, err = ctx.compute(name)
+	if nil == err && !ok {
 		err = fmt.Errorf("Variable %s not exists", name)
 	}
 	return
 }
 
+// Vars : Get copy of all visible variables, bound ptr is dereferenced. Lazy variables not computed yet are not included
+func (ctx *DataContext) Vars() map[string]interface{} {
+	vars := make(map[string]interface{})
+	for c := ctx; nil != c; c = c.parent {
+		for name, value := range c.data {
+			if _, ok := vars[name]; !ok {
+				vars[name] = elemCopy(value)
+			}
+		}
+	}
+	for name, value := range ctx.memo {
+		if _, ok := vars[name]; !ok {
+			vars[name] = elemCopy(value)
+		}
+	}
+	return vars
+}
+
+// elemCopy : Copy the value ptr point to, unlike ptrElem the result do not share memory with ptr
+func elemCopy(value interface{}) interface{} {
+	vValue := reflect.ValueOf(value)
+	if reflect.Ptr != vValue.Kind() || vValue.IsNil() {
+		return value
+	}
+	return vValue.Elem().Interface()
+}
+
 // Set set data, Now just support map[string]interface{} type
 func (ctx *DataContext) Set(name string, value reflect.Value) (err error) {
-	data, ok := ctx.data[name]
+	if err = ctx.checkWritable(name); nil != err {
+		return
+	}
+	ctx.shadow(name)
+	data, _, ok := ctx.lookup(name)
 	if !ok {
 		_, err = setMapValue(reflect.ValueOf(ctx.data), reflect.ValueOf(name), value)
 		return
@@ -82,7 +547,7 @@ func (ctx *DataContext) Set(name string, value reflect.Value) (err error) {
 		elem = elem.Elem()
 		err = updateElem(elem, value)
 	} else {
-		// update temporary variable
+		// update temporary variable, always in current context
 		elem = reflect.ValueOf(ctx.data)
 		_, err = setMapValue(elem, reflect.ValueOf(name), value)
 	}
@@ -198,7 +663,7 @@ func setMapValue(elem reflect.Value, fieldName reflect.Value, value reflect.Valu
 		return nilValue, err
 	}
 
-	vKey, err := typeConvert(fieldName, tKey)
+	vKey, err := mapKey(ptrElem(fieldName.Interface()), tKey)
 	if nil != err {
 		return nilValue, err
 	}
@@ -208,10 +673,10 @@ func setMapValue(elem reflect.Value, fieldName reflect.Value, value reflect.Valu
 }
 
 func setSliceValue(elem reflect.Value, vIndex reflect.Value, vValue reflect.Value) (ret reflect.Value, err error) {
-	if !IsInt(vIndex.Kind()) {
-		return nilValue, fmt.Errorf("Set by index expect int type not %v", vIndex.Kind())
+	i, err := valueIndex(vIndex)
+	if nil != err {
+		return nilValue, err
 	}
-	i := int(vIndex.Int())
 	if i < 0 || i >= elem.Len() {
 		return nilValue, fmt.Errorf("Slice index out of range: %d", i)
 	}
@@ -224,6 +689,14 @@ func setSliceValue(elem reflect.Value, vIndex reflect.Value, vValue reflect.Valu
 	return
 }
 
+// valueIndex : Index of slice like reads, float without fraction is an index too
+func valueIndex(vIndex reflect.Value) (int, error) {
+	if !vIndex.IsValid() {
+		return toIndex(nil)
+	}
+	return toIndex(ptrElem(vIndex.Interface()))
+}
+
 func canBeInt(value string) bool {
 	_, err := strconv.Atoi(value)
 	if nil != err {
@@ -234,6 +707,9 @@ func canBeInt(value string) bool {
 
 func updateElem(elem reflect.Value, value reflect.Value) error {
 	if reflect.Interface == elem.Kind() {
+		if !value.IsValid() {
+			value = reflect.Zero(elem.Type())
+		}
 		elem.Set(value)
 	} else {
 		vValue, err := typeConvert(value, elem.Type())
@@ -0,0 +1,173 @@
+package geval
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Coverage : Count executions of statements and if/else branches across many evals.
+// One Coverage can be attached to many rule nodes, rules are told apart by their name
+type Coverage struct {
+	NopHooks
+	mu       sync.Mutex
+	rules    int
+	blocks   map[ast.Stmt]*coverBlock
+	branches map[*ast.IfStmt]*BranchCoverage
+}
+
+// coverBlock : One statement in rule text, for if and for statement only the header is covered
+type coverBlock struct {
+	start token.Position
+	end   token.Position
+	count int64
+}
+
+// BranchCoverage : How many times each branch of an if statement is taken
+type BranchCoverage struct {
+	File   string
+	Line   int
+	Column int
+	Then   int64
+	Else   int64
+}
+
+// NewCoverage : Create an empty coverage collector
+func NewCoverage() *Coverage {
+	return &Coverage{
+		blocks:   make(map[ast.Stmt]*coverBlock),
+		branches: make(map[*ast.IfStmt]*BranchCoverage),
+	}
+}
+
+// Attach : Collect coverage of rule node, node without name is reported as file `rule<N>.go`
+func (cov *Coverage) Attach(ruleNode *RuleNode) {
+	cov.mu.Lock()
+	defer cov.mu.Unlock()
+
+	cov.rules++
+	file := fmt.Sprintf("rule%d.go", cov.rules)
+	position := func(pos token.Pos) token.Position {
+		position := ruleNode.rulePosition(pos)
+		if "" == position.Filename {
+			position.Filename = file
+		}
+		return position
+	}
+
+	var inspect func(node ast.Node) bool
+	inspect = func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.BlockStmt:
+			return true
+		case *ast.IfStmt:
+			// init statement is part of the if header
+			cov.addBlock(position, n, n.Body.Lbrace)
+			pos := position(n.Pos())
+			cov.branches[n] = &BranchCoverage{File: pos.Filename, Line: pos.Line, Column: pos.Column}
+			ast.Inspect(n.Body, inspect)
+			if nil != n.Else {
+				ast.Inspect(n.Else, inspect)
+			}
+			return false
+		case *ast.ForStmt:
+			cov.addBlock(position, n, n.Body.Lbrace)
+			ast.Inspect(n.Body, inspect)
+			return false
+		case *ast.RangeStmt:
+			cov.addBlock(position, n, n.Body.Lbrace)
+			ast.Inspect(n.Body, inspect)
+			return false
+		case ast.Stmt:
+			cov.addBlock(position, n, n.End())
+			return false
+		}
+		return true
+	}
+	ast.Inspect(ruleNode.astFile.Decls[0].(*ast.FuncDecl).Body, inspect)
+	ruleNode.AddHooks(cov)
+}
+
+func (cov *Coverage) addBlock(position func(token.Pos) token.Position, node ast.Stmt, end token.Pos) {
+	cov.blocks[node] = &coverBlock{
+		start: position(node.Pos()),
+		end:   position(end),
+	}
+}
+
+// BeforeStmt : Count statement
+func (cov *Coverage) BeforeStmt(pos token.Position, node ast.Stmt) error {
+	cov.mu.Lock()
+	if block, ok := cov.blocks[node]; ok {
+		block.count++
+	}
+	cov.mu.Unlock()
+	return nil
+}
+
+// OnBranch : Count branch
+func (cov *Coverage) OnBranch(pos token.Position, node *ast.IfStmt, taken bool) {
+	cov.mu.Lock()
+	if branch, ok := cov.branches[node]; ok {
+		if taken {
+			branch.Then++
+		} else {
+			branch.Else++
+		}
+	}
+	cov.mu.Unlock()
+}
+
+// Branches : Get branch coverage of all if statements, ordered by position
+func (cov *Coverage) Branches() []BranchCoverage {
+	cov.mu.Lock()
+	defer cov.mu.Unlock()
+
+	branches := make([]BranchCoverage, 0, len(cov.branches))
+	for _, branch := range cov.branches {
+		branches = append(branches, *branch)
+	}
+	sort.Slice(branches, func(i, j int) bool {
+		a, b := branches[i], branches[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return branches
+}
+
+// WriteProfile : Write statement coverage in `go tool cover` profile format, positions are in the rule text
+func (cov *Coverage) WriteProfile(w io.Writer) error {
+	cov.mu.Lock()
+	blocks := make([]coverBlock, 0, len(cov.blocks))
+	for _, block := range cov.blocks {
+		blocks = append(blocks, *block)
+	}
+	cov.mu.Unlock()
+
+	sort.Slice(blocks, func(i, j int) bool {
+		a, b := blocks[i].start, blocks[j].start
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Offset < b.Offset
+	})
+
+	if _, err := fmt.Fprintln(w, "mode: count"); nil != err {
+		return err
+	}
+	for _, block := range blocks {
+		_, err := fmt.Fprintf(w, "%s:%d.%d,%d.%d 1 %d\n", block.start.Filename, block.start.Line, block.start.Column, block.end.Line, block.end.Column, block.count)
+		if nil != err {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,502 @@
+package geval
+
+import (
+	"encoding/csv"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// HitPolicy : How decision table handle rows matched at the same time
+type HitPolicy string
+
+const (
+	// HitFirst : Only the first matched row is applied
+	HitFirst HitPolicy = "first"
+	// HitUnique : At most one row can match, it is an error if several rows match
+	HitUnique HitPolicy = "unique"
+	// HitCollect : All matched rows are applied in row order
+	HitCollect HitPolicy = "collect"
+	// HitPriority : Matched row with highest value in priority column is applied
+	HitPriority HitPolicy = "priority"
+)
+
+// maxTableRegions : Limit of input combinations checked when searching missing rows
+const maxTableRegions = 100000
+
+// DecisionTable : Table compiled from csv. Header cell is `when:<expr>` for condition column,
+// `then:<target>` for action column and `priority` for priority column, other columns are ignored.
+// Condition cell is a test on the column expression:
+//
+//	-, empty      any value
+//	> 10, <= 10   compare, operator is one of == != < <= > >=
+//	[10..20)      range, use ( ) for open end and [ ] for closed end
+//	gold, 10      equal, word not number or bool is taken as string
+//
+// Action cell is an expression assigned to the target, empty cell is skipped. Cells are csv fields,
+// quotes of geval string should be doubled in quoted field, like `"""gold"""`
+type DecisionTable struct {
+	name       string
+	policy     HitPolicy
+	conditions []string
+	actions    []string
+	rows       []*tableRow
+}
+
+// tableRow : One row of table, condition and action are compiled to rule nodes
+type tableRow struct {
+	line     int
+	tests    []*cellTest
+	priority float64
+	when     *RuleNode
+	then     *RuleNode
+}
+
+// TableIssue : Problem found by Validate, Kind is `overlap` or `gap`. Lines are line numbers of
+// overlapped rows, Example is an input matched by these rows or by no row
+type TableIssue struct {
+	Kind    string
+	Lines   []int
+	Example map[string]interface{}
+}
+
+// cellTest : Parsed condition cell, value is float64, string or bool
+type cellTest struct {
+	any     bool
+	op      string
+	value   interface{}
+	lo, hi  float64
+	loOpen  bool
+	hiOpen  bool
+	isRange bool
+}
+
+// LoadDecisionTable : Load decision table from csv file
+func LoadDecisionTable(file string, policy HitPolicy, funcCtx *FunContext) (*DecisionTable, error) {
+	f, err := os.Open(file)
+	if nil != err {
+		return nil, err
+	}
+	defer f.Close()
+	return NewDecisionTable(file, f, policy, funcCtx)
+}
+
+// NewDecisionTable : Compile decision table from csv, name is used as file name in errors.
+// All errors are reported at once as scanner.ErrorList
+func NewDecisionTable(name string, r io.Reader, policy HitPolicy, funcCtx *FunContext) (*DecisionTable, error) {
+	switch policy {
+	case HitFirst, HitUnique, HitCollect, HitPriority:
+	default:
+		return nil, fmt.Errorf("Hit policy not support: %s", policy)
+	}
+
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if nil != err {
+		return nil, err
+	}
+	if 0 == len(records) {
+		return nil, fmt.Errorf("%s: table is empty", name)
+	}
+
+	table := &DecisionTable{name: name, policy: policy}
+	errs := scanner.ErrorList{}
+	errorf := func(line int, column int, format string, args ...interface{}) {
+		errs.Add(token.Position{Filename: name, Line: line, Column: column}, fmt.Sprintf(format, args...))
+	}
+
+	// column index of conditions, actions and priority
+	var whenCols, thenCols []int
+	priorityCol := -1
+	for i, header := range records[0] {
+		header = strings.TrimSpace(header)
+		switch {
+		case strings.HasPrefix(header, "when:"):
+			whenCols = append(whenCols, i)
+			table.conditions = append(table.conditions, strings.TrimSpace(header[5:]))
+		case strings.HasPrefix(header, "then:"):
+			thenCols = append(thenCols, i)
+			table.actions = append(table.actions, strings.TrimSpace(header[5:]))
+		case "priority" == header:
+			priorityCol = i
+		}
+	}
+	if 0 == len(thenCols) {
+		errorf(1, 0, "table has no action column")
+	}
+	if HitPriority == policy && priorityCol < 0 {
+		errorf(1, 0, "priority column is required by hit policy priority")
+	}
+
+	for i, record := range records[1:] {
+		line := i + 2
+		row := &tableRow{line: line}
+		conds := []string{}
+		for j, col := range whenCols {
+			test, err := parseCellTest(record[col])
+			if nil != err {
+				errorf(line, col+1, "%v", err)
+				continue
+			}
+			row.tests = append(row.tests, test)
+			if !test.any {
+				conds = append(conds, test.expr("("+table.conditions[j]+")"))
+			}
+		}
+
+		stmts := []string{}
+		for j, col := range thenCols {
+			if cell := strings.TrimSpace(record[col]); "" != cell {
+				stmts = append(stmts, fmt.Sprintf("%s = %s", table.actions[j], cell))
+			}
+		}
+		if priorityCol >= 0 {
+			if row.priority, err = strconv.ParseFloat(strings.TrimSpace(record[priorityCol]), 64); nil != err {
+				errorf(line, priorityCol+1, "invalid priority: %s", record[priorityCol])
+			}
+		}
+		if len(row.tests) != len(whenCols) {
+			continue
+		}
+
+		when := "return true"
+		if len(conds) > 0 {
+			when = "return " + strings.Join(conds, " && ")
+		}
+		ruleName := fmt.Sprintf("%s:%d", name, line)
+		if row.when, err = NewRuleNode(when, funcCtx); nil != err {
+			errorf(line, 0, "condition error: %v", err)
+			continue
+		}
+		if row.then, err = NewRuleNode(strings.Join(stmts, "\n"), funcCtx); nil != err {
+			errorf(line, 0, "action error: %v", err)
+			continue
+		}
+		row.when.SetName(ruleName)
+		row.then.SetName(ruleName)
+		table.rows = append(table.rows, row)
+	}
+
+	if err = errs.Err(); nil != err {
+		return nil, err
+	}
+	return table, nil
+}
+
+// Eval : Check rows and apply actions by hit policy, line numbers of applied rows are returned
+func (table *DecisionTable) Eval(dataCtx *DataContext) ([]int, error) {
+	var matched []*tableRow
+	for _, row := range table.rows {
+		result, err := row.when.EvalResult(dataCtx)
+		if nil != err {
+			return nil, fmt.Errorf("%s:%d: %v", table.name, row.line, err)
+		}
+		if ok, _ := result[0].(bool); !ok {
+			continue
+		}
+		matched = append(matched, row)
+		if HitFirst == table.policy {
+			break
+		}
+	}
+
+	switch table.policy {
+	case HitUnique:
+		if len(matched) > 1 {
+			return nil, fmt.Errorf("%s: rows %v match at the same time, hit policy is unique", table.name, rowLines(matched))
+		}
+	case HitPriority:
+		sort.SliceStable(matched, func(i, j int) bool {
+			return matched[i].priority > matched[j].priority
+		})
+		if len(matched) > 1 {
+			matched = matched[:1]
+		}
+	}
+
+	for _, row := range matched {
+		if err := row.then.Eval(dataCtx); nil != err {
+			return nil, fmt.Errorf("%s:%d: %v", table.name, row.line, err)
+		}
+	}
+	return rowLines(matched), nil
+}
+
+// Validate : Report rows match the same input and inputs match no row. Overlap is not reported for
+// hit policy collect, and only reported for rows with the same priority for hit policy priority
+func (table *DecisionTable) Validate() []TableIssue {
+	regions := make([][]interface{}, len(table.conditions))
+	total := 1
+	for col := range table.conditions {
+		regions[col] = table.regions(col)
+		if total <= maxTableRegions {
+			total *= len(regions[col])
+		}
+	}
+
+	var issues []TableIssue
+	if HitCollect != table.policy {
+		for i, a := range table.rows {
+			for _, b := range table.rows[i+1:] {
+				if HitPriority == table.policy && a.priority != b.priority {
+					continue
+				}
+				if example, ok := table.overlap(a, b, regions); ok {
+					issues = append(issues, TableIssue{Kind: "overlap", Lines: []int{a.line, b.line}, Example: example})
+				}
+			}
+		}
+	}
+
+	if total > maxTableRegions {
+		return issues
+	}
+	input := make([]interface{}, len(table.conditions))
+	var walk func(col int)
+	walk = func(col int) {
+		if col == len(table.conditions) {
+			for _, row := range table.rows {
+				if row.match(input) {
+					return
+				}
+			}
+			issues = append(issues, TableIssue{Kind: "gap", Example: table.example(input)})
+			return
+		}
+		for _, value := range regions[col] {
+			input[col] = value
+			walk(col + 1)
+		}
+	}
+	walk(0)
+	return issues
+}
+
+// regions : Representative values of column, one for each range of input no cell can tell apart
+func (table *DecisionTable) regions(col int) []interface{} {
+	var points []float64
+	strs := []interface{}{}
+	seen := make(map[interface{}]bool)
+	for _, row := range table.rows {
+		test := row.tests[col]
+		switch {
+		case test.any:
+		case test.isRange:
+			points = append(points, test.lo, test.hi)
+		default:
+			if f, ok := test.value.(float64); ok {
+				points = append(points, f)
+			} else if !seen[test.value] {
+				seen[test.value] = true
+				strs = append(strs, test.value)
+			}
+		}
+	}
+
+	if len(points) > 0 {
+		sort.Float64s(points)
+		values := []interface{}{points[0] - 1}
+		for i, point := range points {
+			if i > 0 && point == points[i-1] {
+				continue
+			}
+			values = append(values, point)
+			next := point + 1
+			for _, p := range points[i+1:] {
+				if p > point {
+					next = (point + p) / 2
+					break
+				}
+			}
+			values = append(values, next)
+		}
+		return values
+	}
+	if _, isBool := firstValue(strs).(bool); isBool {
+		return []interface{}{true, false}
+	}
+	// unknown value stand for all values not in table
+	return append(strs, unknownValue{})
+}
+
+// unknownValue : Value not equal to any value in table
+type unknownValue struct{}
+
+func (unknownValue) String() string {
+	return "<other>"
+}
+
+func firstValue(list []interface{}) interface{} {
+	if 0 == len(list) {
+		return nil
+	}
+	return list[0]
+}
+
+func (table *DecisionTable) overlap(a *tableRow, b *tableRow, regions [][]interface{}) (map[string]interface{}, bool) {
+	input := make([]interface{}, len(table.conditions))
+	for col := range table.conditions {
+		found := false
+		for _, value := range regions[col] {
+			if a.tests[col].match(value) && b.tests[col].match(value) {
+				input[col] = value
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return table.example(input), true
+}
+
+func (table *DecisionTable) example(input []interface{}) map[string]interface{} {
+	example := make(map[string]interface{})
+	for col, value := range input {
+		example[table.conditions[col]] = value
+	}
+	return example
+}
+
+func (row *tableRow) match(input []interface{}) bool {
+	for col, test := range row.tests {
+		if !test.match(input[col]) {
+			return false
+		}
+	}
+	return true
+}
+
+func rowLines(rows []*tableRow) []int {
+	lines := make([]int, len(rows))
+	for i, row := range rows {
+		lines[i] = row.line
+	}
+	return lines
+}
+
+func parseCellTest(cell string) (*cellTest, error) {
+	cell = strings.TrimSpace(cell)
+	if "" == cell || "-" == cell {
+		return &cellTest{any: true}, nil
+	}
+
+	if strings.Contains(cell, "..") && ('[' == cell[0] || '(' == cell[0]) {
+		last := cell[len(cell)-1]
+		bounds := strings.SplitN(cell[1:len(cell)-1], "..", 2)
+		if (']' != last && ')' != last) || 2 != len(bounds) {
+			return nil, fmt.Errorf("invalid range: %s", cell)
+		}
+		test := &cellTest{isRange: true, loOpen: '(' == cell[0], hiOpen: ')' == last}
+		var err error
+		if test.lo, err = strconv.ParseFloat(strings.TrimSpace(bounds[0]), 64); nil != err {
+			return nil, fmt.Errorf("invalid range: %s", cell)
+		}
+		if test.hi, err = strconv.ParseFloat(strings.TrimSpace(bounds[1]), 64); nil != err {
+			return nil, fmt.Errorf("invalid range: %s", cell)
+		}
+		return test, nil
+	}
+
+	test := &cellTest{op: "=="}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if strings.HasPrefix(cell, op) {
+			test.op = op
+			cell = strings.TrimSpace(cell[len(op):])
+			break
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(cell, `"`):
+		str, err := strconv.Unquote(cell)
+		if nil != err {
+			return nil, fmt.Errorf("invalid string: %s", cell)
+		}
+		test.value = str
+	case "true" == cell || "false" == cell:
+		test.value = "true" == cell
+	case "" == cell:
+		return nil, fmt.Errorf("missing value: %s", test.op)
+	default:
+		if f, err := strconv.ParseFloat(cell, 64); nil == err {
+			test.value = f
+		} else {
+			test.value = cell
+		}
+	}
+	if _, isNum := test.value.(float64); !isNum && "==" != test.op && "!=" != test.op {
+		return nil, fmt.Errorf("operator %s need number: %s", test.op, cell)
+	}
+	return test, nil
+}
+
+// expr : Geval expression of test on subject
+func (test *cellTest) expr(subject string) string {
+	if test.isRange {
+		lo, hi := ">=", "<="
+		if test.loOpen {
+			lo = ">"
+		}
+		if test.hiOpen {
+			hi = "<"
+		}
+		return fmt.Sprintf("%s %s %s && %s %s %s", subject, lo, formatNumber(test.lo), subject, hi, formatNumber(test.hi))
+	}
+	switch v := test.value.(type) {
+	case float64:
+		return fmt.Sprintf("%s %s %s", subject, test.op, formatNumber(v))
+	case string:
+		return fmt.Sprintf("%s %s %s", subject, test.op, strconv.Quote(v))
+	default:
+		return fmt.Sprintf("%s %s %v", subject, test.op, v)
+	}
+}
+
+// match : Check representative value of validation
+func (test *cellTest) match(value interface{}) bool {
+	if test.any {
+		return true
+	}
+	f, isNum := value.(float64)
+	if test.isRange {
+		if !isNum {
+			return false
+		}
+		return (f > test.lo || !test.loOpen && f == test.lo) && (f < test.hi || !test.hiOpen && f == test.hi)
+	}
+	switch test.op {
+	case "==":
+		return value == test.value
+	case "!=":
+		return value != test.value
+	}
+	bound, _ := test.value.(float64)
+	switch test.op {
+	case "<":
+		return isNum && f < bound
+	case "<=":
+		return isNum && f <= bound
+	case ">":
+		return isNum && f > bound
+	case ">=":
+		return isNum && f >= bound
+	}
+	return false
+}
+
+// formatNumber : Integer is written without decimal point, so it compares with int data
+func formatNumber(f float64) string {
+	if f == math.Trunc(f) && math.Abs(f) < 1e15 {
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -1,15 +1,46 @@
 package geval
 
-// Gengine : todo
+// Gengine : Rule engine, rules share data and functions bound to the engine
 type Gengine interface {
-	AddRule(ruleNode RuleNode, priority int) error
+	AddRule(ruleNode *RuleNode, priority int) error
 	AddData(name string, data interface{}) error
 	AddFunc(name string, fun interface{}) error
 	Eval() error
 }
 
-// BaseEngine : todo
+// BaseEngine : Data and functions shared by rules of engine
 type BaseEngine struct {
 	dataCtx *DataContext
 	funcCtx *FunContext
 }
+
+func newBaseEngine() BaseEngine {
+	return BaseEngine{dataCtx: NewDataCtx(), funcCtx: NewFunCtx()}
+}
+
+// AddData : Bind data to engine, data must be ptr
+func (engine *BaseEngine) AddData(name string, data interface{}) error {
+	return engine.dataCtx.Bind(name, data)
+}
+
+// AddFunc : Bind function to engine
+func (engine *BaseEngine) AddFunc(name string, fun interface{}) error {
+	return engine.funcCtx.Bind(name, fun)
+}
+
+// DataCtx : Data context of engine, use it to bind read only or lazy data
+func (engine *BaseEngine) DataCtx() *DataContext {
+	return engine.dataCtx
+}
+
+// FunCtx : Function context of engine, use it to bind packages
+func (engine *BaseEngine) FunCtx() *FunContext {
+	return engine.funcCtx
+}
+
+// attach : Rule created without FunContext use functions of engine
+func (engine *BaseEngine) attach(ruleNode *RuleNode) {
+	if nil == ruleNode.funcCtx {
+		ruleNode.funcCtx = engine.funcCtx
+	}
+}
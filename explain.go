@@ -0,0 +1,165 @@
+package geval
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"reflect"
+	"strings"
+)
+
+// Explain : Tree explain why a rule do what it did, it mirror the ast of the rule.
+// Kind is one of rule, if, for, stmt, then, else and binary
+type Explain struct {
+	Kind     string     `json:"kind"`
+	Pos      string     `json:"pos,omitempty"`
+	Text     string     `json:"text"`
+	Skipped  bool       `json:"skipped,omitempty"`
+	Error    string     `json:"error,omitempty"`
+	Children []*Explain `json:"children,omitempty"`
+}
+
+// explainer : Build explain tree during eval
+type explainer struct {
+	root  *Explain
+	stack []*Explain
+}
+
+// EvalExplain : Run a node and return explain tree, like `order.Total (120) > 100 → true`.
+// Explain tree is returned with the failed node marked even if eval fail
+func (ruleNode *RuleNode) EvalExplain(dataCtx *DataContext) (*Explain, error) {
+	root := &Explain{Kind: "rule"}
+	ev := ruleNode.newEvaluator(dataCtx)
+	ev.explain = &explainer{root: root, stack: []*Explain{root}}
+
+	err := ev.run()
+	if nil != err {
+		root.Error = err.Error()
+	}
+	return root, err
+}
+
+// String : Render explain tree as indented text
+func (explain *Explain) String() string {
+	builder := &strings.Builder{}
+	explain.render(builder, 0)
+	return builder.String()
+}
+
+// JSON : Render explain tree as json
+func (explain *Explain) JSON() ([]byte, error) {
+	return json.Marshal(explain)
+}
+
+func (explain *Explain) render(builder *strings.Builder, depth int) {
+	if "rule" != explain.Kind {
+		builder.WriteString(strings.Repeat("  ", depth))
+		switch {
+		case "then" == explain.Kind || "else" == explain.Kind:
+			builder.WriteString(explain.Kind)
+		case "" != explain.Pos:
+			builder.WriteString(explain.Pos + ": " + explain.Text)
+		default:
+			builder.WriteString(explain.Text)
+		}
+		if explain.Skipped {
+			builder.WriteString(" (skipped)")
+		}
+		if "" != explain.Error {
+			builder.WriteString(" → error: " + explain.Error)
+		}
+		builder.WriteString("\n")
+		depth++
+	}
+	for _, child := range explain.Children {
+		child.render(builder, depth)
+	}
+}
+
+// open : Add a node under current node and make it current
+func (e *explainer) open(kind string, text string, pos token.Position) *Explain {
+	node := &Explain{Kind: kind, Text: text}
+	if "binary" != kind {
+		node.Pos = fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	}
+	top := e.stack[len(e.stack)-1]
+	top.Children = append(top.Children, node)
+	e.stack = append(e.stack, node)
+	return node
+}
+
+// close : Leave node, it should be the current one
+func (e *explainer) close(node *Explain, err error) {
+	if nil != err && !isBranchToken(err) {
+		node.Error = err.Error()
+	}
+	e.stack = e.stack[:len(e.stack)-1]
+}
+
+func (e *explainer) closeBinary(node *Explain, ruleNode *RuleNode, expr *ast.BinaryExpr, left, right interface{}, shortCircuit bool, ret interface{}, err error) {
+	if nil == err {
+		rightText := explainOperand(ruleNode, expr.Y, right)
+		if shortCircuit {
+			rightText = ruleNode.nodeSource(expr.Y) + " (not evaluated)"
+		}
+		node.Text = fmt.Sprintf("%s %s %s → %v", explainOperand(ruleNode, expr.X, left), expr.Op, rightText, explainValue(ret))
+	}
+	e.close(node, err)
+}
+
+// explainStmt : Run statement with explain node
+func (ev *evaluator) explainStmt(stmt ast.Stmt) (ret reflect.Value, err error) {
+	if _, isBlock := stmt.(*ast.BlockStmt); isBlock {
+		return ev.evalNode(stmt)
+	}
+
+	kind := "stmt"
+	text := ev.nodeSource(stmt)
+	switch n := stmt.(type) {
+	case *ast.IfStmt:
+		kind = "if"
+		text = strings.TrimSpace(ev.src[ev.fset.Position(n.Pos()).Offset:ev.fset.Position(n.Body.Lbrace).Offset])
+	case *ast.ForStmt:
+		kind = "for"
+		text = strings.TrimSpace(ev.src[ev.fset.Position(n.Pos()).Offset:ev.fset.Position(n.Body.Lbrace).Offset])
+	case *ast.RangeStmt:
+		kind = "for"
+		text = strings.TrimSpace(ev.src[ev.fset.Position(n.Pos()).Offset:ev.fset.Position(n.Body.Lbrace).Offset])
+	}
+
+	explain := ev.explain.open(kind, text, ev.rulePosition(stmt.Pos()))
+	ret, err = ev.evalNode(stmt)
+	ev.explain.close(explain, err)
+	return
+}
+
+// skipBranch : Mark branch of if statement not run
+func (ev *evaluator) skipBranch(kind string, branch ast.Stmt) {
+	if nil == ev.explain || nil == branch {
+		return
+	}
+	explain := ev.explain.open(kind, "", ev.rulePosition(branch.Pos()))
+	explain.Skipped = true
+	ev.explain.close(explain, nil)
+}
+
+func explainOperand(ruleNode *RuleNode, expr ast.Expr, value interface{}) string {
+	src := ruleNode.nodeSource(expr)
+	if _, isLit := expr.(*ast.BasicLit); isLit {
+		return src
+	}
+	return fmt.Sprintf("%s (%v)", src, explainValue(value))
+}
+
+func explainValue(value interface{}) interface{} {
+	return elemCopy(value)
+}
+
+func isBranchToken(err error) bool {
+	switch err.Error() {
+	case TOKEN_BREAK, TOKEN_CONTINUE, TOKEN_RETURN:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,300 @@
+package geval
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// DefaultMaxFlowSteps : Default limit of nodes run in one Run of Flow
+const DefaultMaxFlowSteps = 1000
+
+// FlowStep : Work done by flow node, RuleNode and RuleSet are flow steps
+type FlowStep interface {
+	Eval(dataCtx *DataContext) error
+}
+
+// FlowNode : Node of flow. Step is run when flow reaches node, Rule is rule source compiled as step,
+// Ref names step given when loading flow from json. Node without step only routes the flow.
+// Exclusive node follows the first edge whose guard is true, fork node follows all of them.
+// Join node waits for branches that may still reach it and runs once
+type FlowNode struct {
+	Name string   `json:"name"`
+	Step FlowStep `json:"-"`
+	Rule string   `json:"rule,omitempty"`
+	Ref  string   `json:"ref,omitempty"`
+	Fork bool     `json:"fork,omitempty"`
+	Join bool     `json:"join,omitempty"`
+}
+
+// FlowEdge : Edge of flow, When is geval expression, empty When is always true
+type FlowEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	When string `json:"when,omitempty"`
+}
+
+// FlowVisit : Node run by flow, From are nodes flow came from and Next are nodes flow went to
+type FlowVisit struct {
+	Node string
+	From []string
+	Next []string
+}
+
+// Flow : Graph of rules run against one DataContext. Branches of fork node are not run concurrently,
+// they run one by one in the order they are reached, so flow gets the same result and path every time
+type Flow struct {
+	name     string
+	start    string
+	funcCtx  *FunContext
+	maxSteps int
+	nodes    map[string]*flowNode
+}
+
+type flowNode struct {
+	FlowNode
+	edges []*flowEdge
+}
+
+type flowEdge struct {
+	FlowEdge
+	guard *RuleNode
+}
+
+// flowDefine : Json format of flow
+type flowDefine struct {
+	Name  string     `json:"name"`
+	Start string     `json:"start"`
+	Nodes []FlowNode `json:"nodes"`
+	Edges []FlowEdge `json:"edges"`
+}
+
+// NewFlow : Create empty flow, rules are compiled with funcCtx
+func NewFlow(name string, funcCtx *FunContext) *Flow {
+	return &Flow{
+		name:     name,
+		funcCtx:  funcCtx,
+		maxSteps: DefaultMaxFlowSteps,
+		nodes:    make(map[string]*flowNode),
+	}
+}
+
+// LoadFlow : Load flow from json, steps are nodes referred by `ref`
+func LoadFlow(data []byte, steps map[string]FlowStep, funcCtx *FunContext) (*Flow, error) {
+	define := flowDefine{}
+	if err := json.Unmarshal(data, &define); nil != err {
+		return nil, err
+	}
+
+	flow := NewFlow(define.Name, funcCtx)
+	for _, node := range define.Nodes {
+		if "" != node.Ref {
+			step, ok := steps[node.Ref]
+			if !ok {
+				return nil, fmt.Errorf("Flow %s: step '%s' of node '%s' not exists", define.Name, node.Ref, node.Name)
+			}
+			node.Step = step
+		}
+		if err := flow.AddNode(node); nil != err {
+			return nil, err
+		}
+	}
+	for _, edge := range define.Edges {
+		if err := flow.AddEdge(edge); nil != err {
+			return nil, err
+		}
+	}
+	if "" != define.Start {
+		if err := flow.SetStart(define.Start); nil != err {
+			return nil, err
+		}
+	}
+	return flow, nil
+}
+
+// Name : Name of flow
+func (flow *Flow) Name() string {
+	return flow.name
+}
+
+// SetMaxSteps : Limit of nodes run in one Run, flow with loop fails when it is exceeded
+func (flow *Flow) SetMaxSteps(maxSteps int) {
+	flow.maxSteps = maxSteps
+}
+
+// SetStart : Set node flow starts from, default is the first node added
+func (flow *Flow) SetStart(name string) error {
+	if _, ok := flow.nodes[name]; !ok {
+		return fmt.Errorf("Flow %s: node '%s' not exists", flow.name, name)
+	}
+	flow.start = name
+	return nil
+}
+
+// AddNode : Add node, name of node should be unique
+func (flow *Flow) AddNode(node FlowNode) error {
+	if "" == node.Name {
+		return fmt.Errorf("Flow %s: node name is empty", flow.name)
+	}
+	if _, ok := flow.nodes[node.Name]; ok {
+		return fmt.Errorf("Flow %s: node '%s' have added before", flow.name, node.Name)
+	}
+	if "" != node.Rule {
+		if nil != node.Step {
+			return fmt.Errorf("Flow %s: node '%s' has both step and rule", flow.name, node.Name)
+		}
+		ruleNode, err := newRuleNode(node.Name, node.Rule, flow.funcCtx)
+		if nil != err {
+			return err
+		}
+		node.Step = ruleNode
+	}
+	if ruleNode, ok := node.Step.(*RuleNode); ok && nil == ruleNode.funcCtx {
+		ruleNode.funcCtx = flow.funcCtx
+	}
+
+	flow.nodes[node.Name] = &flowNode{FlowNode: node}
+	if "" == flow.start {
+		flow.start = node.Name
+	}
+	return nil
+}
+
+// AddEdge : Add edge between nodes, edges are checked in add order
+func (flow *Flow) AddEdge(edge FlowEdge) error {
+	from, ok := flow.nodes[edge.From]
+	if !ok {
+		return fmt.Errorf("Flow %s: node '%s' not exists", flow.name, edge.From)
+	}
+	if _, ok = flow.nodes[edge.To]; !ok {
+		return fmt.Errorf("Flow %s: node '%s' not exists", flow.name, edge.To)
+	}
+
+	e := &flowEdge{FlowEdge: edge}
+	if "" != edge.When {
+		guard, err := newCondNode(edge.From+"->"+edge.To, edge.When, flow.funcCtx)
+		if nil != err {
+			return err
+		}
+		e.guard = guard
+	}
+	from.edges = append(from.edges, e)
+	return nil
+}
+
+// Run : Run flow from start node until no branch goes on, nodes run are returned in order.
+// If a node fails, path till the failed node is returned with error
+func (flow *Flow) Run(dataCtx *DataContext) ([]FlowVisit, error) {
+	if "" == flow.start {
+		return nil, fmt.Errorf("Flow %s has no node", flow.name)
+	}
+
+	type token struct {
+		node string
+		from []string
+	}
+	queue := []token{{node: flow.start}}
+	// joins reached by some branches, in the order they are reached
+	var joins []string
+	waiting := make(map[string][]string)
+
+	var path []FlowVisit
+	for steps := 0; ; steps++ {
+		var current token
+		if len(queue) > 0 {
+			current, queue = queue[0], queue[1:]
+		} else if len(joins) > 0 {
+			i := flow.readyJoin(joins)
+			current = token{node: joins[i], from: waiting[joins[i]]}
+			joins = append(joins[:i], joins[i+1:]...)
+			delete(waiting, current.node)
+		} else {
+			return path, nil
+		}
+		if steps >= flow.maxSteps {
+			return path, fmt.Errorf("Flow %s: run more than %d nodes", flow.name, flow.maxSteps)
+		}
+
+		node := flow.nodes[current.node]
+		visit := FlowVisit{Node: node.Name, From: current.from}
+		if nil != node.Step {
+			if err := node.Step.Eval(dataCtx); nil != err {
+				return append(path, visit), fmt.Errorf("Flow %s: node %s: %v", flow.name, node.Name, err)
+			}
+		}
+		next, err := flow.follow(node, dataCtx)
+		visit.Next = next
+		path = append(path, visit)
+		if nil != err {
+			return path, err
+		}
+
+		for _, name := range next {
+			if !flow.nodes[name].Join {
+				queue = append(queue, token{node: name, from: []string{node.Name}})
+				continue
+			}
+			if _, ok := waiting[name]; !ok {
+				joins = append(joins, name)
+			}
+			waiting[name] = append(waiting[name], node.Name)
+		}
+	}
+}
+
+// follow : Names of nodes flow goes to after node
+func (flow *Flow) follow(node *flowNode, dataCtx *DataContext) ([]string, error) {
+	var next []string
+	for _, edge := range node.edges {
+		if nil != edge.guard {
+			taken, err := evalCond(edge.guard, dataCtx)
+			if nil != err {
+				return next, fmt.Errorf("Flow %s: edge %s: %v", flow.name, edge.guard.Name(), err)
+			}
+			if !taken {
+				continue
+			}
+		}
+		next = append(next, edge.To)
+		if !node.Fork {
+			break
+		}
+	}
+	return next, nil
+}
+
+// readyJoin : Index of join no other waiting join can reach, the first one if joins reach each other
+func (flow *Flow) readyJoin(joins []string) int {
+	for i, join := range joins {
+		ready := true
+		for j, other := range joins {
+			if i != j && flow.reachable(other, join) {
+				ready = false
+				break
+			}
+		}
+		if ready {
+			return i
+		}
+	}
+	return 0
+}
+
+// reachable : Check whether there is a path from node to target, guards are ignored
+func (flow *Flow) reachable(from string, target string) bool {
+	seen := map[string]bool{from: true}
+	stack := []string{from}
+	for len(stack) > 0 {
+		name := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, edge := range flow.nodes[name].edges {
+			if edge.To == target {
+				return true
+			}
+			if !seen[edge.To] {
+				seen[edge.To] = true
+				stack = append(stack, edge.To)
+			}
+		}
+	}
+	return false
+}
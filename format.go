@@ -0,0 +1,111 @@
+package geval
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"strings"
+)
+
+// Format : Pretty print rule content like gofmt, comments are kept.
+// Syntax error positions are lines in rule content
+func Format(rule string) (string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", wrapRule(rule), parser.ParseComments)
+	if nil != err {
+		return "", ruleSyntaxError(err, "", rule)
+	}
+
+	buf := &bytes.Buffer{}
+	if err = format.Node(buf, fset, file); nil != err {
+		return "", err
+	}
+
+	// parse printed source again to find lines of main body
+	src := buf.String()
+	fset = token.NewFileSet()
+	file, err = parser.ParseFile(fset, "", src, 0)
+	if nil != err {
+		return "", err
+	}
+	body := file.Decls[0].(*ast.FuncDecl).Body
+	first := fset.Position(body.Lbrace).Line + 1
+	last := fset.Position(body.Rbrace).Line - 1
+
+	// lines inside raw string keep their indent
+	keep := make(map[int]bool)
+	ast.Inspect(body, func(node ast.Node) bool {
+		if lit, ok := node.(*ast.BasicLit); ok && token.STRING == lit.Kind && '`' == lit.Value[0] {
+			for line := fset.Position(lit.Pos()).Line + 1; line <= fset.Position(lit.End()).Line; line++ {
+				keep[line] = true
+			}
+		}
+		return true
+	})
+
+	lines := strings.Split(src, "\n")
+	out := make([]string, 0, last-first+1)
+	for line := first; line <= last; line++ {
+		text := lines[line-1]
+		if !keep[line] {
+			text = strings.TrimPrefix(text, "\t")
+		}
+		out = append(out, text)
+	}
+	return strings.Join(out, "\n"), nil
+}
+
+// CanonicalHash : Hash of rule ast, rules only differ in formatting and comments get same hash
+func CanonicalHash(rule string) (string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", wrapRule(rule), 0)
+	if nil != err {
+		return "", ruleSyntaxError(err, "", rule)
+	}
+	return canonicalHash(file)
+}
+
+// CanonicalHash : Hash of rule ast, same as CanonicalHash of rule content
+func (ruleNode *RuleNode) CanonicalHash() (string, error) {
+	return canonicalHash(ruleNode.astFile)
+}
+
+func canonicalHash(file *ast.File) (string, error) {
+	encoder := &astEncoder{noPos: true}
+	record, err := encoder.encode(file.Decls[0].(*ast.FuncDecl).Body)
+	if nil != err {
+		return "", err
+	}
+	data, err := json.Marshal(record)
+	if nil != err {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ruleSyntaxError : Move positions of parse error from wrapped source to rule content.
+// Errors after the end of content are caused by earlier ones, they are dropped
+func ruleSyntaxError(err error, name string, content string) error {
+	list, ok := err.(scanner.ErrorList)
+	if !ok {
+		return err
+	}
+	lastLine := strings.Count(content, "\n") + 1
+	result := scanner.ErrorList{}
+	for _, e := range list {
+		e.Pos.Line -= ruleLineOffset
+		e.Pos.Filename = name
+		if e.Pos.Line > lastLine && len(result) > 0 {
+			continue
+		}
+		result = append(result, e)
+	}
+	return result
+}
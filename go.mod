@@ -1,6 +1,6 @@
 module github.com/MagicYH/geval
 
-go 1.13
+go 1.16
 
 require (
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
@@ -0,0 +1,202 @@
+package geval
+
+import (
+	"errors"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"reflect"
+)
+
+// EvalHooks : Callbacks during eval, positions are in the user's rule text
+type EvalHooks interface {
+	// BeforeStmt is called before a statement is run, return error to abort the eval
+	BeforeStmt(pos token.Position, node ast.Stmt) error
+	// AfterExpr is called after an expression is evaluated
+	AfterExpr(pos token.Position, value interface{})
+	// OnCall is called after a function is called
+	OnCall(name string, args []interface{}, results []interface{})
+}
+
+// BranchHooks : Optional interface of EvalHooks, OnBranch is called after condition of if statement is evaluated
+type BranchHooks interface {
+	OnBranch(pos token.Position, node *ast.IfStmt, taken bool)
+}
+
+// NopHooks : EvalHooks do nothing, embed it to implement part of the callbacks
+type NopHooks struct{}
+
+// BeforeStmt : Do nothing
+func (NopHooks) BeforeStmt(pos token.Position, node ast.Stmt) error {
+	return nil
+}
+
+// AfterExpr : Do nothing
+func (NopHooks) AfterExpr(pos token.Position, value interface{}) {}
+
+// OnCall : Do nothing
+func (NopHooks) OnCall(name string, args []interface{}, results []interface{}) {}
+
+// AddHooks : Attach hooks to node, hooks are called in the order they are added. Hooks are taken when
+// eval start, do not add or remove them while the node is evaluated by other goroutines
+func (ruleNode *RuleNode) AddHooks(hooks EvalHooks) {
+	ruleNode.hooks = append(ruleNode.hooks, hooks)
+}
+
+// RemoveHooks : Detach hooks from node
+func (ruleNode *RuleNode) RemoveHooks(hooks EvalHooks) {
+	for i, h := range ruleNode.hooks {
+		if h == hooks {
+			ruleNode.hooks = append(ruleNode.hooks[:i:i], ruleNode.hooks[i+1:]...)
+			return
+		}
+	}
+}
+
+func (ev *evaluator) beforeStmt(node ast.Stmt) error {
+	if _, isBlock := node.(*ast.BlockStmt); isBlock {
+		return nil
+	}
+	pos := ev.rulePosition(node.Pos())
+	for _, hooks := range ev.hooks {
+		if err := hooks.BeforeStmt(pos, node); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ev *evaluator) afterExpr(node ast.Expr, value interface{}) {
+	pos := ev.rulePosition(node.Pos())
+	for _, hooks := range ev.hooks {
+		hooks.AfterExpr(pos, value)
+	}
+}
+
+func (ev *evaluator) onBranch(node *ast.IfStmt, taken bool) {
+	pos := ev.rulePosition(node.Pos())
+	for _, hooks := range ev.hooks {
+		if branchHooks, ok := hooks.(BranchHooks); ok {
+			branchHooks.OnBranch(pos, node, taken)
+		}
+	}
+}
+
+func (ev *evaluator) onCall(node *ast.CallExpr, args []reflect.Value, results []interface{}) {
+	name := types.ExprString(node.Fun)
+	argList := make([]interface{}, len(args))
+	for i, arg := range args {
+		if arg.IsValid() && arg.CanInterface() {
+			argList[i] = arg.Interface()
+		}
+	}
+	for _, hooks := range ev.hooks {
+		hooks.OnCall(name, argList, results)
+	}
+}
+
+// nodeSource : Source text of node
+func (ruleNode *RuleNode) nodeSource(node ast.Node) string {
+	start := ruleNode.fset.Position(node.Pos()).Offset
+	end := ruleNode.fset.Position(node.End()).Offset
+	if start < 0 || end > len(ruleNode.src) || start > end {
+		return ""
+	}
+	return ruleNode.src[start:end]
+}
+
+// DebugAction : What debugger do after a break
+type DebugAction int
+
+const (
+	// DebugContinue : Run until next breakpoint
+	DebugContinue DebugAction = iota
+	// DebugStep : Break again before next statement
+	DebugStep
+	// DebugAbort : Stop the eval with error
+	DebugAbort
+)
+
+// ErrDebugAbort : Returned by Eval when debugger abort it
+var ErrDebugAbort = errors.New("Eval aborted by debugger")
+
+// BreakEvent : State of the rule when debugger break
+type BreakEvent struct {
+	Pos    token.Position
+	Node   ast.Stmt
+	Source string
+	// Vars is visible variables in DataContext with ptr dereferenced
+	Vars map[string]interface{}
+}
+
+// Debugger : Step through a rule, onBreak is called before statement on breakpoint line or when stepping,
+// it may block until user decide what to do next
+type Debugger struct {
+	NopHooks
+	ruleNode    *RuleNode
+	dataCtx     *DataContext
+	breakpoints map[int]bool
+	stepping    bool
+	onBreak     func(event *BreakEvent) DebugAction
+}
+
+// NewDebugger : Create debugger on rule node, it is attached to node until Detach is called
+func NewDebugger(ruleNode *RuleNode, dataCtx *DataContext, onBreak func(event *BreakEvent) DebugAction) *Debugger {
+	debugger := &Debugger{
+		ruleNode:    ruleNode,
+		dataCtx:     dataCtx,
+		breakpoints: make(map[int]bool),
+		onBreak:     onBreak,
+	}
+	ruleNode.AddHooks(debugger)
+	return debugger
+}
+
+// SetBreakpoint : Break before statements start on line of the rule text, line start from 1
+func (debugger *Debugger) SetBreakpoint(line int) {
+	debugger.breakpoints[line] = true
+}
+
+// ClearBreakpoint : Remove breakpoint on line
+func (debugger *Debugger) ClearBreakpoint(line int) {
+	delete(debugger.breakpoints, line)
+}
+
+// Step : Break before the first statement of next eval
+func (debugger *Debugger) Step() {
+	debugger.stepping = true
+}
+
+// Detach : Remove debugger from rule node
+func (debugger *Debugger) Detach() {
+	debugger.ruleNode.RemoveHooks(debugger)
+}
+
+// Eval : Run rule with debugger's DataContext
+func (debugger *Debugger) Eval() error {
+	return debugger.ruleNode.Eval(debugger.dataCtx)
+}
+
+// BeforeStmt : Break if needed
+func (debugger *Debugger) BeforeStmt(pos token.Position, node ast.Stmt) error {
+	if !debugger.stepping && !debugger.breakpoints[pos.Line] {
+		return nil
+	}
+
+	event := &BreakEvent{
+		Pos:    pos,
+		Node:   node,
+		Source: debugger.ruleNode.nodeSource(node),
+		Vars:   debugger.dataCtx.Vars(),
+	}
+	switch debugger.onBreak(event) {
+	case DebugStep:
+		debugger.stepping = true
+	case DebugAbort:
+		debugger.stepping = false
+		return ErrDebugAbort
+	default:
+		debugger.stepping = false
+	}
+	return nil
+}
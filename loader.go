@@ -0,0 +1,248 @@
+package geval
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// RuleManifest : Name of manifest file in rule directory, if it exists only rules listed in it are loaded
+const RuleManifest = "rules.json"
+
+// RuleExt : Extension of rule file
+const RuleExt = ".rule"
+
+// RuleMeta : Metadata of rule. In rule file it is written as header comments before the first statement, like
+//
+//	// @name: vip_discount
+//	// @priority: 10
+//	// @enabled: false
+//	// @tags: order, discount
+//	// @description: Discount for vip user
+//	// @owner: trade-team
+type RuleMeta struct {
+	Name        string   `json:"name"`
+	Priority    int      `json:"priority"`
+	Enabled     bool     `json:"enabled"`
+	Tags        []string `json:"tags,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Owner       string   `json:"owner,omitempty"`
+}
+
+// RuleEntry : Rule loaded from file, Node is named with Meta.Name, positions of Node still point to File
+type RuleEntry struct {
+	RuleMeta
+	File string
+	Node *RuleNode
+}
+
+// manifestRule : Rule item in manifest, fields set here override header of rule file
+type manifestRule struct {
+	File        string   `json:"file"`
+	Name        string   `json:"name"`
+	Priority    *int     `json:"priority"`
+	Enabled     *bool    `json:"enabled"`
+	Tags        []string `json:"tags"`
+	Description string   `json:"description"`
+	Owner       string   `json:"owner"`
+}
+
+// ruleLoader : Collect entries and all errors of a load
+type ruleLoader struct {
+	fsys    fs.FS
+	funcCtx *FunContext
+	entries []*RuleEntry
+	errs    scanner.ErrorList
+}
+
+// LoadRuleDir : Load rules in directory, see LoadRules
+func LoadRuleDir(dir string, funcCtx *FunContext) ([]*RuleEntry, error) {
+	return LoadRules(os.DirFS(dir), funcCtx)
+}
+
+// LoadRules : Load rules from fsys. If RuleManifest exists in root, rules listed in it are loaded,
+// otherwise all `.rule` files are loaded in path order. All errors are reported at once as
+// scanner.ErrorList with file:line positions
+func LoadRules(fsys fs.FS, funcCtx *FunContext) ([]*RuleEntry, error) {
+	loader := &ruleLoader{fsys: fsys, funcCtx: funcCtx}
+
+	data, err := fs.ReadFile(fsys, RuleManifest)
+	switch {
+	case nil == err:
+		loader.loadManifest(data)
+	case os.IsNotExist(err):
+		err = fs.WalkDir(fsys, ".", func(file string, d fs.DirEntry, err error) error {
+			if nil != err {
+				return err
+			}
+			if !d.IsDir() && RuleExt == path.Ext(file) {
+				loader.loadFile(file, nil)
+			}
+			return nil
+		})
+		if nil != err {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	loader.checkNames()
+	if err = loader.errs.Err(); nil != err {
+		return nil, err
+	}
+	return loader.entries, nil
+}
+
+func (loader *ruleLoader) errorf(file string, line int, format string, args ...interface{}) {
+	loader.errs.Add(token.Position{Filename: file, Line: line}, fmt.Sprintf(format, args...))
+}
+
+func (loader *ruleLoader) loadManifest(data []byte) {
+	manifest := struct {
+		Rules []*manifestRule `json:"rules"`
+	}{}
+	if err := json.Unmarshal(data, &manifest); nil != err {
+		loader.errorf(RuleManifest, 0, "%v", err)
+		return
+	}
+	for i, item := range manifest.Rules {
+		if "" == item.File {
+			loader.errorf(RuleManifest, 0, "rule %d: file is empty", i)
+			continue
+		}
+		loader.loadFile(path.Clean(item.File), item)
+	}
+}
+
+func (loader *ruleLoader) loadFile(file string, item *manifestRule) {
+	data, err := fs.ReadFile(loader.fsys, file)
+	if nil != err {
+		loader.errorf(file, 0, "%v", err)
+		return
+	}
+
+	content := string(data)
+	meta := RuleMeta{
+		Name:    strings.TrimSuffix(path.Base(file), path.Ext(file)),
+		Enabled: true,
+	}
+	if !loader.parseHeader(file, content, &meta) {
+		return
+	}
+	if nil != item {
+		item.apply(&meta)
+	}
+
+	node, err := newRuleNode(file, content, loader.funcCtx)
+	if nil != err {
+		if list, ok := err.(scanner.ErrorList); ok {
+			list.RemoveMultiples()
+			loader.errs = append(loader.errs, list...)
+		} else {
+			loader.errorf(file, 0, "%v", err)
+		}
+		return
+	}
+	node.file = file
+	node.SetName(meta.Name)
+	loader.entries = append(loader.entries, &RuleEntry{RuleMeta: meta, File: file, Node: node})
+}
+
+// parseHeader : Parse `// @key: value` comments before the first statement. Header is kept in rule
+// content, so lines of rule are the same as lines of file
+func (loader *ruleLoader) parseHeader(file string, content string, meta *RuleMeta) bool {
+	ok := true
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if "" == line {
+			continue
+		}
+		if !strings.HasPrefix(line, "//") {
+			break
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "//"))
+		if !strings.HasPrefix(line, "@") {
+			continue
+		}
+
+		kv := strings.SplitN(line[1:], ":", 2)
+		if 2 != len(kv) {
+			loader.errorf(file, i+1, "invalid header: %s", line)
+			ok = false
+			continue
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		var err error
+		switch key {
+		case "name":
+			meta.Name = value
+		case "priority":
+			meta.Priority, err = strconv.Atoi(value)
+		case "enabled":
+			meta.Enabled, err = strconv.ParseBool(value)
+		case "tags":
+			meta.Tags = splitTags(value)
+		case "description":
+			meta.Description = value
+		case "owner":
+			meta.Owner = value
+		default:
+			err = fmt.Errorf("unknown header '%s'", key)
+		}
+		if nil != err {
+			loader.errorf(file, i+1, "%v", err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// checkNames : Rule name should be unique
+func (loader *ruleLoader) checkNames() {
+	files := make(map[string]string)
+	for _, entry := range loader.entries {
+		if file, ok := files[entry.Name]; ok {
+			loader.errorf(entry.File, 0, "rule name '%s' is used by %s", entry.Name, file)
+			continue
+		}
+		files[entry.Name] = entry.File
+	}
+	loader.errs.Sort()
+}
+
+func (item *manifestRule) apply(meta *RuleMeta) {
+	if "" != item.Name {
+		meta.Name = item.Name
+	}
+	if nil != item.Priority {
+		meta.Priority = *item.Priority
+	}
+	if nil != item.Enabled {
+		meta.Enabled = *item.Enabled
+	}
+	if nil != item.Tags {
+		meta.Tags = item.Tags
+	}
+	if "" != item.Description {
+		meta.Description = item.Description
+	}
+	if "" != item.Owner {
+		meta.Owner = item.Owner
+	}
+}
+
+func splitTags(value string) (tags []string) {
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.TrimSpace(tag); "" != tag {
+			tags = append(tags, tag)
+		}
+	}
+	return
+}
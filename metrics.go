@@ -0,0 +1,226 @@
+package geval
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// MetricsSink : Receive performance metrics of rule nodes
+type MetricsSink interface {
+	// ObserveEval is called after each eval, allocs is 0 if allocation tracking is off
+	ObserveEval(rule string, duration time.Duration, allocs uint64, err error)
+	// ObserveCall is called after each bound function called by rule
+	ObserveCall(rule string, fun string, duration time.Duration)
+}
+
+// ruleMetrics : Metrics setting of a rule node
+type ruleMetrics struct {
+	sink        MetricsSink
+	trackAllocs bool
+}
+
+// SetMetrics : Report metrics of node to sink, set nil to turn it off. Tracking allocations use
+// runtime.ReadMemStats which stop the world and count allocations of all goroutines, use it when profiling only.
+// Like hooks, it is taken when eval start and should not be set while the node is evaluated
+func (ruleNode *RuleNode) SetMetrics(sink MetricsSink, trackAllocs bool) {
+	if nil == sink {
+		ruleNode.metrics = nil
+		return
+	}
+	ruleNode.metrics = &ruleMetrics{sink: sink, trackAllocs: trackAllocs}
+}
+
+// metricsName : Name used in metrics, unnamed rule is reported as `unnamed`
+func (ruleNode *RuleNode) metricsName() string {
+	if "" == ruleNode.name {
+		return "unnamed"
+	}
+	return ruleNode.name
+}
+
+// beginEval : Start timing an eval, call the returned func when eval finish
+func (m *ruleMetrics) beginEval(ruleNode *RuleNode) func(err error) {
+	var memStats runtime.MemStats
+	var mallocs uint64
+	if m.trackAllocs {
+		runtime.ReadMemStats(&memStats)
+		mallocs = memStats.Mallocs
+	}
+	start := time.Now()
+
+	return func(err error) {
+		duration := time.Since(start)
+		var allocs uint64
+		if m.trackAllocs {
+			runtime.ReadMemStats(&memStats)
+			allocs = memStats.Mallocs - mallocs
+		}
+		m.sink.ObserveEval(ruleNode.metricsName(), duration, allocs, err)
+	}
+}
+
+// maxSamples : Latest durations kept for percentile of each rule
+const maxSamples = 1024
+
+// MemMetrics : In memory MetricsSink, percentiles are computed from the latest 1024 evals
+type MemMetrics struct {
+	mu    sync.Mutex
+	rules map[string]*ruleStat
+}
+
+type ruleStat struct {
+	count   int64
+	errors  int64
+	total   time.Duration
+	allocs  uint64
+	samples []time.Duration
+	next    int
+	calls   map[string]*CallStats
+}
+
+// RuleStats : Metrics of one rule
+type RuleStats struct {
+	Rule   string
+	Count  int64
+	Errors int64
+	Total  time.Duration
+	P50    time.Duration
+	P90    time.Duration
+	P99    time.Duration
+	// Allocs is allocations per eval
+	Allocs uint64
+	Calls  []CallStats
+}
+
+// CallStats : Metrics of one bound function called by a rule
+type CallStats struct {
+	Func  string
+	Count int64
+	Total time.Duration
+}
+
+// NewMemMetrics : Create in memory metrics sink
+func NewMemMetrics() *MemMetrics {
+	return &MemMetrics{rules: make(map[string]*ruleStat)}
+}
+
+func (m *MemMetrics) getRule(rule string) *ruleStat {
+	stat, ok := m.rules[rule]
+	if !ok {
+		stat = &ruleStat{calls: make(map[string]*CallStats)}
+		m.rules[rule] = stat
+	}
+	return stat
+}
+
+// ObserveEval : Record eval
+func (m *MemMetrics) ObserveEval(rule string, duration time.Duration, allocs uint64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stat := m.getRule(rule)
+	stat.count++
+	stat.total += duration
+	stat.allocs += allocs
+	if nil != err {
+		stat.errors++
+	}
+	if len(stat.samples) < maxSamples {
+		stat.samples = append(stat.samples, duration)
+	} else {
+		stat.samples[stat.next] = duration
+		stat.next = (stat.next + 1) % maxSamples
+	}
+}
+
+// ObserveCall : Record function call
+func (m *MemMetrics) ObserveCall(rule string, fun string, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stat := m.getRule(rule)
+	call, ok := stat.calls[fun]
+	if !ok {
+		call = &CallStats{Func: fun}
+		stat.calls[fun] = call
+	}
+	call.Count++
+	call.Total += duration
+}
+
+// Stats : Get metrics of all rules, slowest rule first
+func (m *MemMetrics) Stats() []RuleStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := make([]RuleStats, 0, len(m.rules))
+	for name, stat := range m.rules {
+		samples := append([]time.Duration(nil), stat.samples...)
+		sort.Slice(samples, func(i, j int) bool {
+			return samples[i] < samples[j]
+		})
+		rule := RuleStats{
+			Rule:   name,
+			Count:  stat.count,
+			Errors: stat.errors,
+			Total:  stat.total,
+			P50:    percentile(samples, 50),
+			P90:    percentile(samples, 90),
+			P99:    percentile(samples, 99),
+		}
+		if stat.count > 0 {
+			rule.Allocs = stat.allocs / uint64(stat.count)
+		}
+		for _, call := range stat.calls {
+			rule.Calls = append(rule.Calls, *call)
+		}
+		sort.Slice(rule.Calls, func(i, j int) bool {
+			return rule.Calls[i].Total > rule.Calls[j].Total
+		})
+		list = append(list, rule)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Total > list[j].Total
+	})
+	return list
+}
+
+// Dump : Write metrics as table
+func (m *MemMetrics) Dump(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RULE\tCOUNT\tERRORS\tTOTAL\tAVG\tP50\tP90\tP99\tALLOCS/EVAL")
+	stats := m.Stats()
+	for _, rule := range stats {
+		avg := time.Duration(0)
+		if rule.Count > 0 {
+			avg = rule.Total / time.Duration(rule.Count)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%v\t%v\t%v\t%v\t%v\t%d\n", rule.Rule, rule.Count, rule.Errors, rule.Total, avg, rule.P50, rule.P90, rule.P99, rule.Allocs)
+	}
+
+	fmt.Fprintln(tw, "")
+	fmt.Fprintln(tw, "RULE\tFUNC\tCALLS\tTOTAL\tAVG")
+	for _, rule := range stats {
+		for _, call := range rule.Calls {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%v\t%v\n", rule.Rule, call.Func, call.Count, call.Total, call.Total/time.Duration(call.Count))
+		}
+	}
+	return tw.Flush()
+}
+
+// percentile : Get percentile p of sorted samples
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if 0 == len(sorted) {
+		return 0
+	}
+	i := (len(sorted)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
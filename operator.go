@@ -0,0 +1,77 @@
+package geval
+
+import (
+	"fmt"
+	"go/token"
+	"reflect"
+)
+
+// Adder : User type supporting `a + b`, `b + a` is taken as `a + b` if b is not Adder
+type Adder interface {
+	Add(other interface{}) (interface{}, error)
+}
+
+// Subtracter : User type supporting `a - b`
+type Subtracter interface {
+	Sub(other interface{}) (interface{}, error)
+}
+
+// Multiplier : User type supporting `a * b`, `b * a` is taken as `a * b` if b is not Multiplier
+type Multiplier interface {
+	Mul(other interface{}) (interface{}, error)
+}
+
+// Divider : User type supporting `a / b`
+type Divider interface {
+	Div(other interface{}) (interface{}, error)
+}
+
+// arith : Do math of binary operator, user types are checked before strings and numbers
+func arith(a, b interface{}, op token.Token) (interface{}, error) {
+	if fn := mathMethod(a, op); nil != fn {
+		return fn(ptrElem(b))
+	}
+	if token.ADD == op || token.MUL == op {
+		// commutative operator can be done by the right side
+		if fn := mathMethod(b, op); nil != fn {
+			return fn(ptrElem(a))
+		}
+	}
+
+	if ret, ok, err := timeMath(ptrElem(a), ptrElem(b), op); ok {
+		return ret, err
+	}
+	va, vb := reflect.ValueOf(ptrElem(a)), reflect.ValueOf(ptrElem(b))
+	switch {
+	case isNumberValue(va) && isNumberValue(vb):
+		return doNumMath(a, b, op.String())
+	case token.ADD == op && isStringValue(va) && isStringValue(vb):
+		return va.String() + vb.String(), nil
+	}
+	return nil, fmt.Errorf("Operator %s not defined on %T and %T", op, ptrElem(a), ptrElem(b))
+}
+
+// mathMethod : Method of operator, it may be defined on ptr receiver, so bound data is checked before its value
+func mathMethod(v interface{}, op token.Token) func(interface{}) (interface{}, error) {
+	for _, x := range []interface{}{v, ptrElem(v)} {
+		switch op {
+		case token.ADD:
+			if m, ok := x.(Adder); ok {
+				return m.Add
+			}
+		case token.SUB:
+			if m, ok := x.(Subtracter); ok {
+				return m.Sub
+			}
+		case token.MUL:
+			if m, ok := x.(Multiplier); ok {
+				return m.Mul
+			}
+		case token.QUO:
+			if m, ok := x.(Divider); ok {
+				return m.Div
+			}
+		}
+	}
+	return nil
+}
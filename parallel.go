@@ -0,0 +1,264 @@
+package geval
+
+import (
+	"fmt"
+	"go/ast"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ParallelEngine : Run independent rules in parallel. Read and write paths of rules are derived from ast,
+// rules accessing the same data with at least one write are run in priority order, rules with the same
+// priority in add order, so bound data get the same result as running rules one by one.
+// Variables not bound to engine are local to each rule. Bound data passed to functions and receivers of
+// methods are taken as written, functions should not change data they are not given, like data captured
+// in closure or bound to engine under other names. Functions and lazy variables may be called
+// concurrently, they should be safe for concurrent use
+type ParallelEngine struct {
+	BaseEngine
+	workers int
+	rules   []*parallelRule
+	// plan is cached until rule added
+	plan []*parallelRule
+}
+
+// parallelRule : Rule and its position in dependency graph
+type parallelRule struct {
+	node     *RuleNode
+	name     string
+	priority int
+	deps     *Trace
+	reads    []string
+	writes   []string
+	next     []*parallelRule
+	prev     int
+	level    int
+	// order is index in plan
+	order int
+}
+
+// NewParallelEngine : Create engine run at most workers rules at the same time, 0 means number of CPU
+func NewParallelEngine(workers int) *ParallelEngine {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	return &ParallelEngine{BaseEngine: newBaseEngine(), workers: workers}
+}
+
+// AddRule : Add rule, rule with higher priority run first if it conflicts with others
+func (engine *ParallelEngine) AddRule(ruleNode *RuleNode, priority int) error {
+	for _, rule := range engine.rules {
+		if rule.node == ruleNode {
+			return fmt.Errorf("Rule %s have added before", rule.name)
+		}
+	}
+	engine.attach(ruleNode)
+	name := ruleNode.Name()
+	if "" == name {
+		name = fmt.Sprintf("rule%d", len(engine.rules))
+	}
+
+	deps := ruleNode.Dependencies()
+	deps.Writes = append(deps.Writes, receiverPaths(ruleNode)...)
+	rule := &parallelRule{node: ruleNode, name: name, priority: priority, deps: deps}
+	engine.rules = append(engine.rules, rule)
+	engine.plan = nil
+	return nil
+}
+
+// AddData : Bind data to engine, paths of rules depend on whether data is map or struct
+func (engine *ParallelEngine) AddData(name string, data interface{}) error {
+	engine.plan = nil
+	return engine.BaseEngine.AddData(name, data)
+}
+
+// Plan : Names of rules grouped by level, rules in the same level do not conflict with each other
+func (engine *ParallelEngine) Plan() [][]string {
+	var levels [][]string
+	for _, rule := range engine.buildPlan() {
+		for len(levels) <= rule.level {
+			levels = append(levels, nil)
+		}
+		levels[rule.level] = append(levels[rule.level], rule.name)
+	}
+	return levels
+}
+
+// Eval : Run all rules. If rules fail, the error of the first failed rule in plan order is returned, and bound
+// data is left as running rules one by one until that rule: rules ordered after it are skipped if not started,
+// writes of those already run are rolled back. Writes made inside called functions are not rolled back
+func (engine *ParallelEngine) Eval() error {
+	plan := engine.buildPlan()
+	if 0 == len(plan) {
+		return nil
+	}
+
+	prev := make(map[*parallelRule]int, len(plan))
+	for _, rule := range plan {
+		prev[rule] = rule.prev
+	}
+	errs := make(map[*parallelRule]error)
+	logs := make(map[*parallelRule]*undoLog, len(plan))
+	// first is order of the first failed rule, rules ordered after it are not run
+	first := len(plan)
+	ready := make(chan *parallelRule, len(plan))
+	done := make(chan *parallelRule, len(plan))
+	sent := 0
+	for _, rule := range plan {
+		if 0 == rule.prev {
+			ready <- rule
+			sent++
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < engine.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rule := range ready {
+				mu.Lock()
+				skip := rule.order > first
+				mu.Unlock()
+				if skip {
+					done <- rule
+					continue
+				}
+
+				// not isolated, writes of workers go to engine data, temporary variables stay in child
+				log := &undoLog{}
+				ev := rule.node.newEvaluator(newDataCtx(engine.dataCtx))
+				ev.undoLog = log
+				err := ev.run()
+				mu.Lock()
+				logs[rule] = log
+				if nil != err {
+					errs[rule] = err
+					if rule.order < first {
+						first = rule.order
+					}
+				}
+				mu.Unlock()
+				done <- rule
+			}
+		}()
+	}
+
+	// a rule is sent to workers when all rules before it are done, rules ordered after a failed one are not sent
+	for finished := 0; finished < sent; finished++ {
+		rule := <-done
+		mu.Lock()
+		stop := first
+		mu.Unlock()
+		for _, next := range rule.next {
+			prev[next]--
+			if 0 == prev[next] && next.order < stop {
+				ready <- next
+				sent++
+			}
+		}
+	}
+	close(ready)
+	wg.Wait()
+
+	if first == len(plan) {
+		return nil
+	}
+	for i := len(plan) - 1; i > first; i-- {
+		if log, ok := logs[plan[i]]; ok {
+			log.rollback()
+		}
+	}
+	return fmt.Errorf("Rule %s: %v", plan[first].name, errs[plan[first]])
+}
+
+// buildPlan : Sort rules by priority and link conflicting rules
+func (engine *ParallelEngine) buildPlan() []*parallelRule {
+	if nil != engine.plan || 0 == len(engine.rules) {
+		return engine.plan
+	}
+
+	plan := append([]*parallelRule{}, engine.rules...)
+	sort.SliceStable(plan, func(i, j int) bool {
+		return plan[i].priority > plan[j].priority
+	})
+	for i, rule := range plan {
+		rule.reads = engine.containerPaths(rule.deps.Reads)
+		rule.writes = engine.containerPaths(rule.deps.Writes)
+		rule.next, rule.prev, rule.level, rule.order = nil, 0, 0, i
+	}
+	for j, rule := range plan {
+		for _, before := range plan[:j] {
+			if rulesConflict(before, rule) {
+				before.next = append(before.next, rule)
+				rule.prev++
+				if before.level+1 > rule.level {
+					rule.level = before.level + 1
+				}
+			}
+		}
+	}
+	engine.plan = plan
+	return plan
+}
+
+// rulesConflict : Rules conflict if one writes data the other reads or writes
+func rulesConflict(a *parallelRule, b *parallelRule) bool {
+	return pathsOverlap(a.writes, b.writes) || pathsOverlap(a.writes, b.reads) || pathsOverlap(a.reads, b.writes)
+}
+
+func pathsOverlap(list1 []string, list2 []string) bool {
+	for _, a := range list1 {
+		for _, b := range list2 {
+			if pathOverlap(a, b) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// containerPaths : Cut path at first index or selector not on struct, map can not be written with
+// other access at the same time, even with different keys
+func (engine *ParallelEngine) containerPaths(paths []string) []string {
+	result := make([]string, 0, len(paths))
+	for _, path := range paths {
+		elems := splitPath(path)
+		// lookup do not compute lazy data, unknown data is cut at root
+		data, _, _ := engine.dataCtx.lookup(elems[0])
+		for i, elem := range elems[1:] {
+			if '[' == elem[0] || reflect.Struct != derefValue(reflect.ValueOf(data)).Kind() {
+				elems = elems[:i+1]
+				break
+			}
+			data, _ = getDataBySel(data, elem[1:])
+		}
+		result = append(result, strings.Join(elems, ""))
+	}
+	return result
+}
+
+// receiverPaths : Method may change its receiver, receivers of method calls are taken as written
+func receiverPaths(ruleNode *RuleNode) (paths []string) {
+	locals := ruleNode.localAliases()
+	ast.Inspect(ruleNode.astFile.Decls[0].(*ast.FuncDecl).Body, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || ruleNode.isPackageSel(sel) {
+			return true
+		}
+		path := locals.dataPath(ruleNode.staticPath(sel.X, func(ast.Expr) {}), false)
+		if "" != path {
+			paths = append(paths, path)
+		}
+		return true
+	})
+	return
+}
@@ -0,0 +1,420 @@
+package geval
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strconv"
+)
+
+// DefaultMaxFires : Default limit of rule firing in one Eval of ProductionEngine
+const DefaultMaxFires = 10000
+
+// MainAgendaGroup : Agenda group of rules not set group, it is always at the bottom of focus stack
+const MainAgendaGroup = "MAIN"
+
+// Production : Rule with a condition and an action. When is a bool expression, Then is run when it is true.
+// Empty When is always true
+type Production struct {
+	Name     string
+	Salience int
+	When     string
+	Then     string
+	// NoLoop : Facts modified by the rule itself do not activate it again
+	NoLoop bool
+	// LockOnActive : Rule fires at most once while its agenda group has focus
+	LockOnActive bool
+	// ActivationGroup : Only the first fired rule in group fires, then the group is closed in this Eval
+	ActivationGroup string
+	// AgendaGroup : Rule fires only when its group has focus, default is MainAgendaGroup
+	AgendaGroup string
+}
+
+// Activation : Rule on agenda, it is used by ConflictStrategy to pick the rule to fire
+type Activation struct {
+	Name     string
+	Salience int
+	// Order is the declare order of rule
+	Order int
+	// Recency is larger if rule is activated later
+	Recency int
+	// Specificity is number of tests joined by && in condition
+	Specificity int
+}
+
+// ConflictStrategy : Return true if a should fire before b
+type ConflictStrategy func(a *Activation, b *Activation) bool
+
+// BySalience : Higher salience fire first
+func BySalience(a *Activation, b *Activation) bool {
+	return a.Salience > b.Salience
+}
+
+// ByRecency : Rule activated later fire first
+func ByRecency(a *Activation, b *Activation) bool {
+	return a.Recency > b.Recency
+}
+
+// BySpecificity : Rule with more tests in condition fire first
+func BySpecificity(a *Activation, b *Activation) bool {
+	return a.Specificity > b.Specificity
+}
+
+// ByOrder : Rule declared first fire first
+func ByOrder(a *Activation, b *Activation) bool {
+	return a.Order < b.Order
+}
+
+// Strategies : Combine strategies, next one is used when previous one can not tell the order.
+// Declare order is used at last, so the order is always deterministic
+func Strategies(strategies ...ConflictStrategy) ConflictStrategy {
+	return func(a *Activation, b *Activation) bool {
+		for _, strategy := range strategies {
+			if strategy(a, b) {
+				return true
+			}
+			if strategy(b, a) {
+				return false
+			}
+		}
+		return ByOrder(a, b)
+	}
+}
+
+// ProductionEngine : Forward chaining engine. Data bound to engine are the facts of working memory.
+// A rule is put on agenda when its condition is true, the conflict strategy pick the one to fire.
+// After a rule fires, only conditions reading the paths it wrote are checked again, rules whose
+// condition is still or become true fire again, until no rule can fire.
+// Functions `halt()`, `retract(fact)` and `focus(group)` are bound to engine for rules
+type ProductionEngine struct {
+	BaseEngine
+	rules []*activation
+	// index map root of path read by conditions to rules
+	index    map[string][]*activation
+	strategy ConflictStrategy
+	maxFires int
+	fired    []string
+	// focus is stack of agenda group, top is the last one
+	focus  []string
+	clock  int
+	halted bool
+	// ruleErr is error of built in function called by rule
+	ruleErr error
+}
+
+// activation : State of rule in engine
+type activation struct {
+	Activation
+	production Production
+	when       *RuleNode
+	then       *RuleNode
+	reads      []string
+	dirty      bool
+	matched    bool
+	fired      bool
+	cancelled  bool
+}
+
+// NewProductionEngine : Create a production engine, conflict strategy is salience then declare order
+func NewProductionEngine() *ProductionEngine {
+	engine := &ProductionEngine{
+		BaseEngine: newBaseEngine(),
+		index:      make(map[string][]*activation),
+		strategy:   Strategies(BySalience),
+		maxFires:   DefaultMaxFires,
+	}
+	engine.funcCtx.Bind("halt", engine.halt)
+	engine.funcCtx.Bind("retract", engine.retract)
+	engine.funcCtx.Bind("focus", engine.SetFocus)
+	return engine
+}
+
+// SetMaxFires : Eval fail if rules fire more than max times, it stop rules modify facts endlessly
+func (engine *ProductionEngine) SetMaxFires(max int) {
+	engine.maxFires = max
+}
+
+// SetStrategy : Set conflict strategy, use Strategies to combine them
+func (engine *ProductionEngine) SetStrategy(strategy ConflictStrategy) {
+	engine.strategy = strategy
+}
+
+// SetFocus : Push agenda group to focus stack, rules in it fire before rules of groups below it
+func (engine *ProductionEngine) SetFocus(group string) {
+	if len(engine.focus) > 0 && engine.focus[len(engine.focus)-1] == group {
+		return
+	}
+	engine.focus = append(engine.focus, group)
+}
+
+// Retract : Remove fact from working memory, conditions reading it become false
+func (engine *ProductionEngine) Retract(name string) error {
+	if err := engine.dataCtx.Unbind(name); nil != err {
+		return err
+	}
+	engine.modified(name, nil)
+	return nil
+}
+
+// AddProduction : Compile and add rule, functions of engine are used
+func (engine *ProductionEngine) AddProduction(production Production) error {
+	if "" == production.Name {
+		return fmt.Errorf("Rule name is empty")
+	}
+	for _, a := range engine.rules {
+		if a.Name == production.Name {
+			return fmt.Errorf("Rule '%s' have added before", production.Name)
+		}
+	}
+	if "" == production.AgendaGroup {
+		production.AgendaGroup = MainAgendaGroup
+	}
+
+	var when *RuleNode
+	var err error
+	if "" != production.When {
+		when, err = newCondNode(production.Name, production.When, engine.funcCtx)
+		if nil != err {
+			return err
+		}
+	}
+	then, err := newRuleNode(production.Name, production.Then, engine.funcCtx)
+	if nil != err {
+		return err
+	}
+	engine.add(&activation{production: production, when: when, then: then})
+	return nil
+}
+
+// AddRule : Add rule without condition, it fires once in every Eval. Priority is used as salience
+func (engine *ProductionEngine) AddRule(ruleNode *RuleNode, priority int) error {
+	engine.attach(ruleNode)
+	name := ruleNode.Name()
+	if "" == name {
+		name = fmt.Sprintf("rule%d", len(engine.rules))
+	}
+	production := Production{Name: name, Salience: priority, AgendaGroup: MainAgendaGroup}
+	engine.add(&activation{production: production, then: ruleNode})
+	return nil
+}
+
+func (engine *ProductionEngine) add(a *activation) {
+	retractByName(a.then)
+	a.Name = a.production.Name
+	a.Salience = a.production.Salience
+	a.Order = len(engine.rules)
+	if nil != a.when {
+		a.reads = a.when.Dependencies().Reads
+		a.Specificity = specificity(a.when)
+	}
+	engine.rules = append(engine.rules, a)
+
+	roots := make(map[string]bool)
+	for _, path := range a.reads {
+		root := pathRoot(path)
+		if !roots[root] {
+			roots[root] = true
+			engine.index[root] = append(engine.index[root], a)
+		}
+	}
+}
+
+// Fired : Names of rules fired in last Eval, in fire order
+func (engine *ProductionEngine) Fired() []string {
+	return engine.fired
+}
+
+// Eval : Fire rules until no rule can fire or halt is called. Facts may be changed outside engine
+// between two Evals, so all conditions are checked at start
+func (engine *ProductionEngine) Eval() error {
+	engine.fired = nil
+	engine.halted = false
+	engine.focus = append([]string{MainAgendaGroup}, engine.focus...)
+	defer func() {
+		engine.focus = nil
+	}()
+	for _, a := range engine.rules {
+		a.dirty, a.fired, a.cancelled = true, false, false
+	}
+
+	for fires := 0; !engine.halted; fires++ {
+		if err := engine.match(); nil != err {
+			return err
+		}
+		next := engine.next()
+		if nil == next {
+			return nil
+		}
+		if fires >= engine.maxFires {
+			return fmt.Errorf("Rules fire more than %d times, facts may be modified endlessly", engine.maxFires)
+		}
+		if err := engine.fire(next); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+// match : Check conditions of dirty rules
+func (engine *ProductionEngine) match() error {
+	for _, a := range engine.rules {
+		if !a.dirty {
+			continue
+		}
+		a.dirty = false
+		matched := true
+		if nil != a.when {
+			var err error
+			if matched, err = engine.check(a); nil != err {
+				return err
+			}
+		}
+		if matched && (!a.matched || !a.fired) {
+			engine.clock++
+			a.Recency = engine.clock
+		}
+		a.matched = matched
+	}
+	return nil
+}
+
+func (engine *ProductionEngine) check(a *activation) (bool, error) {
+	// condition reading a missing fact is false
+	for _, path := range a.reads {
+		if _, err := engine.dataCtx.Get(pathRoot(path)); nil != err {
+			return false, nil
+		}
+	}
+
+	matched, err := evalCond(a.when, engine.dataCtx)
+	if nil != err {
+		return false, fmt.Errorf("Rule %s: %v", a.Name, err)
+	}
+	return matched, nil
+}
+
+// next : Pick rule to fire from agenda of focused group, group with empty agenda lose focus
+func (engine *ProductionEngine) next() *activation {
+	for len(engine.focus) > 0 {
+		group := engine.focus[len(engine.focus)-1]
+		var agenda []*activation
+		for _, a := range engine.rules {
+			if a.matched && !a.fired && !a.cancelled && a.production.AgendaGroup == group {
+				agenda = append(agenda, a)
+			}
+		}
+		if len(agenda) > 0 {
+			sort.SliceStable(agenda, func(i, j int) bool {
+				return engine.strategy(&agenda[i].Activation, &agenda[j].Activation)
+			})
+			return agenda[0]
+		}
+		engine.focus = engine.focus[:len(engine.focus)-1]
+	}
+	return nil
+}
+
+func (engine *ProductionEngine) fire(a *activation) error {
+	a.fired = true
+	engine.fired = append(engine.fired, a.Name)
+	if group := a.production.ActivationGroup; "" != group {
+		for _, other := range engine.rules {
+			if other.production.ActivationGroup == group {
+				other.cancelled = true
+			}
+		}
+	}
+
+	engine.ruleErr = nil
+	// not isolated, writes go to facts, temporary variables of rule stay in child and never become facts
+	trace, err := a.then.EvalTrace(newDataCtx(engine.dataCtx))
+	if nil == err {
+		err = engine.ruleErr
+	}
+	if nil != err {
+		return fmt.Errorf("Rule %s: %v", a.Name, err)
+	}
+	for _, path := range trace.Writes {
+		engine.modified(path, a)
+	}
+	return nil
+}
+
+// modified : Mark rules reading path to check again, they can fire again. Source is the rule wrote path
+func (engine *ProductionEngine) modified(path string, source *activation) {
+	for _, a := range engine.index[pathRoot(path)] {
+		if a == source && a.production.NoLoop {
+			continue
+		}
+		for _, read := range a.reads {
+			if pathOverlap(read, path) {
+				a.dirty = true
+				if !a.production.LockOnActive || !engine.hasFocus(a.production.AgendaGroup) {
+					a.fired = false
+				}
+				break
+			}
+		}
+	}
+}
+
+func (engine *ProductionEngine) hasFocus(group string) bool {
+	return len(engine.focus) > 0 && engine.focus[len(engine.focus)-1] == group
+}
+
+// halt : Built in function, stop Eval after current rule
+func (engine *ProductionEngine) halt() {
+	engine.halted = true
+}
+
+// retract : Built in function, fact is name of fact. `retract(coupon)` is compiled to `retract("coupon")`
+// by retractByName, so facts are never looked up by value
+func (engine *ProductionEngine) retract(fact interface{}) {
+	name, ok := fact.(string)
+	if !ok || !engine.dataCtx.isBound(name) {
+		engine.ruleErr = fmt.Errorf("Retract fact not found: %v, retract fact variable or its name", fact)
+		return
+	}
+	engine.ruleErr = engine.Retract(name)
+}
+
+// retractByName : Replace argument of `retract(fact.Field)` with name of its root variable, so fact
+// is found from the argument expression rather than its value. Local variables are kept, they may
+// hold name of fact
+func retractByName(ruleNode *RuleNode) {
+	locals := ruleNode.locals()
+	ast.Inspect(ruleNode.astFile, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok || 1 != len(call.Args) {
+			return true
+		}
+		if fun, ok := call.Fun.(*ast.Ident); !ok || "retract" != fun.Name {
+			return true
+		}
+		root := rootIdent(call.Args[0])
+		if nil == root || locals[root.Name] || "" == identPath(root) {
+			return true
+		}
+		call.Args[0] = &ast.BasicLit{ValuePos: call.Args[0].Pos(), Kind: token.STRING, Value: strconv.Quote(root.Name)}
+		return true
+	})
+}
+
+// specificity : Number of tests joined by && in condition
+func specificity(when *RuleNode) int {
+	ret := when.astFile.Decls[0].(*ast.FuncDecl).Body.List[0].(*ast.ReturnStmt)
+	var count func(expr ast.Expr) int
+	count = func(expr ast.Expr) int {
+		switch n := expr.(type) {
+		case *ast.ParenExpr:
+			return count(n.X)
+		case *ast.BinaryExpr:
+			if token.LAND == n.Op {
+				return count(n.X) + count(n.Y)
+			}
+		}
+		return 1
+	}
+	return count(ret.Results[0])
+}
@@ -26,6 +26,13 @@ func packEface(rtype unsafe.Pointer, ptr unsafe.Pointer) interface{} {
 
 func faceToPrt(obj interface{}) interface{} {
 	cType := reflect.TypeOf(obj)
+	switch cType.Kind() {
+	case reflect.Map, reflect.Chan, reflect.Func, reflect.Ptr, reflect.UnsafePointer:
+		// these types are stored directly in eface.data, it is not a ptr to the value
+		ptr := reflect.New(cType)
+		ptr.Elem().Set(reflect.ValueOf(obj))
+		return ptr.Interface()
+	}
 	pType := reflect.PtrTo(cType)
 	typeFace := unpackEface(pType)
 	e := (*eface)(unsafe.Pointer(&obj))
@@ -35,6 +42,9 @@ func faceToPrt(obj interface{}) interface{} {
 
 func ptrElem(obj interface{}) interface{} {
 	tObj := reflect.TypeOf(obj)
+	if nil == tObj {
+		return obj
+	}
 	kObj := tObj.Kind()
 	if reflect.Ptr == kObj {
 		return reflect2.Type2(tObj.Elem()).Indirect(obj)
@@ -53,3 +63,90 @@ func faceToReal(obj interface{}) interface{} {
 	e.rtype = typeFace.data
 	return obj
 }
+
+// deepCopy : Copy value with all maps, slices and pointers it refers to. Unexported struct fields
+// are shallow copied, chan and func are shared
+func deepCopy(v reflect.Value, seen map[uintptr]reflect.Value) reflect.Value {
+	if !v.IsValid() {
+		return v
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		if c, ok := seen[v.Pointer()]; ok && c.Type() == v.Type() {
+			return c
+		}
+		c := reflect.New(v.Type().Elem())
+		seen[v.Pointer()] = c
+		c.Elem().Set(deepCopy(v.Elem(), seen))
+		return c
+	case reflect.Interface:
+		c := reflect.New(v.Type()).Elem()
+		if !v.IsNil() {
+			c.Set(deepCopy(v.Elem(), seen))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		if c, ok := seen[v.Pointer()]; ok && c.Type() == v.Type() {
+			return c
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		seen[v.Pointer()] = c
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(deepCopy(iter.Key(), seen), deepCopy(iter.Value(), seen))
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i), seen))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i), seen))
+		}
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if field := c.Field(i); field.CanSet() {
+				field.Set(deepCopy(v.Field(i), seen))
+			}
+		}
+		return c
+	}
+	c := reflect.New(v.Type()).Elem()
+	c.Set(v)
+	return c
+}
+
+// sharesMemory : Check if copy of v still share memory with v, like map, slice and ptr
+func sharesMemory(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Ptr, reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return true
+	case reflect.Interface:
+		return !v.IsNil() && sharesMemory(v.Elem())
+	case reflect.Array:
+		return v.Len() > 0 && sharesMemory(reflect.Zero(v.Type().Elem()))
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if sharesMemory(v.Field(i)) {
+				return true
+			}
+		}
+	}
+	return false
+}
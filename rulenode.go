@@ -5,46 +5,199 @@ import (
 	"fmt"
 	"go/ast"
 	"go/parser"
+	"go/scanner"
 	"go/token"
+	"go/types"
 	"reflect"
 	"strconv"
+	"time"
 
 	"github.com/modern-go/reflect2"
 )
 
 // RuleNode : base element of rule node
 type RuleNode struct {
+	name string
+	// file is the file rule is loaded from, it is used in positions instead of name if set
+	file    string
+	src     string
 	fset    *token.FileSet
 	astFile *ast.File
-	dataCtx *DataContext
 	funcCtx *FunContext
+	hooks   []EvalHooks
+	metrics *ruleMetrics
+}
+
+// evaluator : State of one eval of a rule node. Every eval has its own evaluator, so a node can be
+// evaluated by many goroutines at the same time
+type evaluator struct {
+	*RuleNode
+	dataCtx *DataContext
+	undoLog *undoLog
+	tracer  *tracer
+	explain *explainer
+	// hooks and metrics of node are taken when eval start
+	hooks   []EvalHooks
+	metrics *ruleMetrics
+	// lastPath is access path of the value returned by last getData, used by tracer and undoLog
+	lastPath string
+	// locals are variables defined in rule, aliases map local to path of bound data it share memory with,
+	// like `m` of `m := dict`, so writes through the local are traced under the data. Both are only set when tracking
+	locals  map[string]bool
+	aliases map[string]string
+	// result is values of return statement
+	result []interface{}
 }
 
 const TOKEN_BREAK = "TOKEN BREAK"
 const TOKEN_CONTINUE = "TOKEN CONTINUE"
+const TOKEN_RETURN = "TOKEN RETURN"
+
+// ruleLineOffset : lines added in front of the rule content by NewRuleNode's wrapper
+const ruleLineOffset = 2
 
 var nilValue reflect.Value
 
+// wrapRule : Wrap rule content as main function, so it can be parsed as go source
+func wrapRule(content string) string {
+	return "package main\nfunc main() {\n" + content + "\n}"
+}
+
 // NewRuleNode : Create a new rule node
 func NewRuleNode(content string, funcCtx *FunContext) (*RuleNode, error) {
-	src := "package main\nfunc main() {\n" + content + "\n}"
+	return newRuleNode("", content, funcCtx)
+}
+
+// newRuleNode : Create a named rule node, name is used as file name in error positions
+func newRuleNode(name string, content string, funcCtx *FunContext) (*RuleNode, error) {
+	src := wrapRule(content)
 
 	var err error
-	ruleNode := &RuleNode{}
+	ruleNode := &RuleNode{name: name, src: src}
 	ruleNode.fset = token.NewFileSet()
 	ruleNode.funcCtx = funcCtx
 	ruleNode.astFile, err = parser.ParseFile(ruleNode.fset, "", src, parser.AllErrors)
+	if nil != err {
+		return ruleNode, ruleSyntaxError(err, name, content)
+	}
+
+	err = ruleNode.checkPackageCollision()
 	return ruleNode, err
 }
 
-// Eval : Run a node
+// newCondNode : Create a named rule node returning the value of a single expression
+func newCondNode(name string, expr string, funcCtx *FunContext) (*RuleNode, error) {
+	if _, err := parser.ParseExpr(expr); nil != err {
+		return nil, fmt.Errorf("Invalid condition %q: %v", expr, err)
+	}
+	return newRuleNode(name, "return "+expr, funcCtx)
+}
+
+// evalCond : Eval rule node created by newCondNode, the value should be bool
+func evalCond(node *RuleNode, dataCtx *DataContext) (bool, error) {
+	result, err := node.EvalResult(dataCtx)
+	if nil != err {
+		return false, err
+	}
+	if 0 == len(result) {
+		return false, errors.New("Condition has no value")
+	}
+	cond, ok := result[0].(bool)
+	if !ok {
+		return false, fmt.Errorf("Condition should be bool, not %T", result[0])
+	}
+	return cond, nil
+}
+
+// checkPackageCollision : Variables defined by the rule can not use the name of a bound package
+func (ruleNode *RuleNode) checkPackageCollision() (err error) {
+	if !ruleNode.funcCtx.hasPackage() {
+		return
+	}
+
+	ast.Inspect(ruleNode.astFile, func(node ast.Node) bool {
+		if nil != err {
+			return false
+		}
+		var lhs []ast.Expr
+		switch n := node.(type) {
+		case *ast.AssignStmt:
+			lhs = n.Lhs
+		case *ast.IncDecStmt:
+			lhs = []ast.Expr{n.X}
+		}
+		for _, expr := range lhs {
+			ident, ok := expr.(*ast.Ident)
+			if !ok {
+				continue
+			}
+			if _, isPkg := ruleNode.funcCtx.getPackage(ident.Name); isPkg {
+				err = scanner.ErrorList{{
+					Pos: ruleNode.rulePosition(ident.Pos()),
+					Msg: fmt.Sprintf("variable '%s' collides with package '%s'", ident.Name, ident.Name),
+				}}
+				return false
+			}
+		}
+		return true
+	})
+	return
+}
+
+// rulePosition : Position of pos in the user's rule text rather than in the wrapped source
+func (ruleNode *RuleNode) rulePosition(pos token.Pos) token.Position {
+	position := ruleNode.fset.Position(pos)
+	position.Line -= ruleLineOffset
+	position.Filename = ruleNode.fileName()
+	return position
+}
+
+// fileName : File name used in positions, name of rule is used if it is not loaded from file
+func (ruleNode *RuleNode) fileName() string {
+	if "" != ruleNode.file {
+		return ruleNode.file
+	}
+	return ruleNode.name
+}
+
+// SetName : Set name of rule, it is used in reports, and as file name in positions if rule is not loaded from file
+func (ruleNode *RuleNode) SetName(name string) {
+	ruleNode.name = name
+}
+
+// Name : Get name of rule
+func (ruleNode *RuleNode) Name() string {
+	return ruleNode.name
+}
+
+// Eval : Run a node. Node is not changed by eval, it can be evaluated by many goroutines at the same time
+// with different DataContext
 func (ruleNode *RuleNode) Eval(dataCtx *DataContext) (err error) {
-	ruleNode.dataCtx = dataCtx
-	ast.Inspect(ruleNode.astFile.Decls[0].(*ast.FuncDecl), func(node ast.Node) bool {
+	return ruleNode.newEvaluator(dataCtx).run()
+}
+
+// newEvaluator : Prepare an eval of node on dataCtx
+func (ruleNode *RuleNode) newEvaluator(dataCtx *DataContext) *evaluator {
+	return &evaluator{RuleNode: ruleNode, dataCtx: dataCtx, hooks: ruleNode.hooks, metrics: ruleNode.metrics}
+}
+
+// run : Run the rule
+func (ev *evaluator) run() (err error) {
+	if nil != ev.metrics {
+		finish := ev.metrics.beginEval(ev.RuleNode)
+		defer func() {
+			finish(err)
+		}()
+	}
+	ev.dataCtx.beginEval()
+	ast.Inspect(ev.astFile.Decls[0].(*ast.FuncDecl), func(node ast.Node) bool {
 		switch x := node.(type) {
 		case *ast.FuncDecl:
 			// first func declare is main func
-			_, err = ruleNode.evalBlockStmt(x.Body)
+			_, err = ev.evalBlockStmt(x.Body)
+			if nil != err && TOKEN_RETURN == err.Error() {
+				err = nil
+			}
 			return false
 
 		default:
@@ -55,44 +208,67 @@ func (ruleNode *RuleNode) Eval(dataCtx *DataContext) (err error) {
 	return
 }
 
-func (ruleNode *RuleNode) evalBody(bodyNode *ast.BlockStmt) error {
+// EvalResult : Run a node and get values of its return statement, result is nil if rule do not return
+func (ruleNode *RuleNode) EvalResult(dataCtx *DataContext) ([]interface{}, error) {
+	ev := ruleNode.newEvaluator(dataCtx)
+	err := ev.run()
+	return ev.result, err
+}
+
+func (ev *evaluator) evalBody(bodyNode *ast.BlockStmt) error {
 	for _, stmt := range bodyNode.List {
-		ruleNode.eval(stmt)
+		ev.eval(stmt)
 	}
 	return nil
 }
 
-func (ruleNode *RuleNode) eval(node ast.Node) (reflect.Value, error) {
+func (ev *evaluator) eval(node ast.Node) (reflect.Value, error) {
+	if stmt, ok := node.(ast.Stmt); ok && len(ev.hooks) > 0 {
+		if err := ev.beforeStmt(stmt); nil != err {
+			return nilValue, err
+		}
+	}
+	if stmt, ok := node.(ast.Stmt); ok && nil != ev.explain {
+		return ev.explainStmt(stmt)
+	}
+	return ev.evalNode(node)
+}
+
+func (ev *evaluator) evalNode(node ast.Node) (reflect.Value, error) {
 	switch n := node.(type) {
 	case *ast.AssignStmt:
-		err := ruleNode.evalAssignStmt(n)
+		err := ev.evalAssignStmt(n)
 		if nil != err {
 			return nilValue, err
 		}
 		return nilValue, nil
 	case *ast.ExprStmt:
-		return ruleNode.evalExprStmt(n)
+		return ev.evalExprStmt(n)
 	case *ast.CallExpr:
-		_, err := ruleNode.evalCallExpr(n)
+		_, err := ev.evalCallExpr(n)
 		return nilValue, err
 	case *ast.SelectorExpr:
-		return ruleNode.evalSelectorExpr(n)
+		return ev.evalSelectorExpr(n)
 	case *ast.IfStmt:
-		_, err := ruleNode.evalIfStmt(n)
+		_, err := ev.evalIfStmt(n)
 		return nilValue, err
 	case *ast.BlockStmt:
-		return ruleNode.evalBlockStmt(n)
+		return ev.evalBlockStmt(n)
 	case *ast.ForStmt:
-		return ruleNode.evalForStmt(n)
+		return ev.evalForStmt(n)
+	case *ast.RangeStmt:
+		return ev.evalRangeStmt(n)
 	case *ast.IncDecStmt:
-		return ruleNode.evalIncDecStmt(n)
+		return ev.evalIncDecStmt(n)
 	case *ast.BranchStmt:
-		return ruleNode.evalBranchStmt(n)
+		return ev.evalBranchStmt(n)
+	case *ast.ReturnStmt:
+		return nilValue, ev.evalReturnStmt(n)
 	}
 	return nilValue, fmt.Errorf("Node type not support: %s", reflect.TypeOf(node).String())
 }
 
-func (ruleNode *RuleNode) evalAssignStmt(node *ast.AssignStmt) (err error) {
+func (ev *evaluator) evalAssignStmt(node *ast.AssignStmt) (err error) {
 	// Just support one element right side
 	if 1 != len(node.Rhs) {
 		return errors.New("Rhs's length should be one")
@@ -100,102 +276,200 @@ func (ruleNode *RuleNode) evalAssignStmt(node *ast.AssignStmt) (err error) {
 
 	switch n := node.Rhs[0].(type) {
 	case *ast.CallExpr:
-		value, err := ruleNode.evalCallExpr(n)
+		var value []interface{}
+		value, err = ev.evalCallExpr(n)
+		if nil != err {
+			return err
+		}
 		if len(value) == len(node.Lhs) {
 			for i, setNode := range node.Lhs {
-				err = ruleNode.setData(setNode, reflect.ValueOf(value[i]), node.Tok)
+				err = ev.setData(setNode, reflect.ValueOf(value[i]), node.Tok)
 				if nil != err {
 					break
 				}
+				// result of function has no data path
+				ev.trackAlias(setNode, n, "", value[i])
 			}
 		} else {
 			err = fmt.Errorf("REsult element number is no equal")
 		}
 
 	default:
-		value, err := ruleNode.getData(n)
+		var value interface{}
+		value, err = ev.getData(n)
 		if nil != err {
 			return err
 		}
-		err = ruleNode.setData(node.Lhs[0], reflect.ValueOf(value), node.Tok)
+		path := ev.lastPath
+		err = ev.setData(node.Lhs[0], reflect.ValueOf(value), node.Tok)
+		if nil == err {
+			ev.trackAlias(node.Lhs[0], n, path, value)
+		}
 	}
 
 	return
 }
 
-func (ruleNode *RuleNode) evalParenExpr(node *ast.ParenExpr) (ret reflect.Value, err error) {
-	return ruleNode.eval(node.X)
+func (ev *evaluator) evalParenExpr(node *ast.ParenExpr) (ret reflect.Value, err error) {
+	return ev.eval(node.X)
 }
 
-func (ruleNode *RuleNode) evalBinaryExpr(node *ast.BinaryExpr) (ret interface{}, err error) {
+func (ev *evaluator) evalBinaryExpr(node *ast.BinaryExpr) (ret interface{}, err error) {
 	var left, right interface{}
-	left, err = ruleNode.getData(node.X)
+	// shortCircuit is true if right side of && or || is not evaluated
+	shortCircuit := false
+	if nil != ev.explain {
+		explain := ev.explain.open("binary", ev.nodeSource(node), ev.rulePosition(node.Pos()))
+		defer func() {
+			ev.explain.closeBinary(explain, ev.RuleNode, node, left, right, shortCircuit, ret, err)
+		}()
+	}
+
+	left, err = ev.getData(node.X)
 	if nil != err {
 		return
 	}
 
-	right, err = ruleNode.getData(node.Y)
+	if token.LAND == node.Op || token.LOR == node.Op {
+		var cond bool
+		if cond, err = toBool(left, node.Op); nil != err || cond == (token.LOR == node.Op) {
+			// short circuit, right side is not evaluated
+			shortCircuit = true
+			return cond, err
+		}
+		right, err = ev.getData(node.Y)
+		if nil != err {
+			return
+		}
+		return toBool(right, node.Op)
+	}
+
+	right, err = ev.getData(node.Y)
 	if nil != err {
 		return
 	}
 
 	switch node.Op.String() {
-	case "+":
-		return add(left, right)
-	case "==":
-		return equ(left, right)
-	case "!=":
-		return neq(left, right)
-	case "-", "*", "/", "<", ">", "<=", ">=":
-		return doNumMath(left, right, node.Op.String())
+	case "+", "-", "*", "/":
+		return arith(left, right, node.Op)
+	case "==", "!=", "<", ">", "<=", ">=":
+		return compare(left, right, node.Op)
 	}
 	return nil, errors.New("Operate not define")
 }
 
+func (ev *evaluator) evalUnaryExpr(node *ast.UnaryExpr) (ret interface{}, err error) {
+	x, err := ev.getData(node.X)
+	if nil != err {
+		return
+	}
+
+	switch node.Op {
+	case token.NOT:
+		var cond bool
+		cond, err = toBool(x, node.Op)
+		return !cond, err
+	case token.SUB:
+		if d, ok := ptrElem(x).(time.Duration); ok {
+			// number math turns duration to float
+			return -d, nil
+		}
+		return doNumMath(0, x, node.Op.String())
+	case token.ADD:
+		return ptrElem(x), nil
+	}
+	return nil, fmt.Errorf("Unary operate not support: %s", node.Op)
+}
+
 func (ruleNode *RuleNode) evalBasicLit(node *ast.BasicLit) (ret interface{}, err error) {
 	switch node.Kind {
 	case token.INT:
-		return strconv.Atoi(node.Value)
+		// base 0 accept prefix like 0x, 0o, 0b and underscore like Go
+		var i int64
+		i, err = strconv.ParseInt(node.Value, 0, 64)
+		return int(i), err
 	case token.FLOAT:
 		return strconv.ParseFloat(node.Value, 64)
+	case token.IMAG:
+		return strconv.ParseComplex(node.Value, 128)
 	case token.STRING:
-		str := node.Value
-		strLen := len(str)
-		return str[1 : strLen-1], nil
+		return strconv.Unquote(node.Value)
+	case token.CHAR:
+		var str string
+		if str, err = strconv.Unquote(node.Value); nil != err {
+			return nil, err
+		}
+		return []rune(str)[0], nil
 	}
 	return nil, fmt.Errorf("Basic token not support: %d", node.Kind)
 }
 
-func (ruleNode *RuleNode) evalExpr() (ret reflect.Value, err error) {
+func (ev *evaluator) evalExpr() (ret reflect.Value, err error) {
 	return
 }
 
-func (ruleNode *RuleNode) evalExprStmt(node *ast.ExprStmt) (reflect.Value, error) {
-	return ruleNode.eval(node.X)
+func (ev *evaluator) evalExprStmt(node *ast.ExprStmt) (reflect.Value, error) {
+	return ev.eval(node.X)
 }
 
-func (ruleNode *RuleNode) evalIfStmt(node *ast.IfStmt) (ret interface{}, err error) {
+func (ev *evaluator) evalIfStmt(node *ast.IfStmt) (ret interface{}, err error) {
 	// run init
 	if nil != node.Init {
-		ruleNode.eval(node.Init)
+		ev.eval(node.Init)
 	}
 
-	cond, err := ruleNode.getData(node.Cond)
+	cond, err := ev.evalCondExpr(node.Cond)
 	if nil != err {
 		return nil, err
 	}
 
-	if cond.(bool) {
-		_, err = ruleNode.eval(node.Body)
-	} else if nil != node.Else {
-		_, err = ruleNode.eval(node.Else)
+	if len(ev.hooks) > 0 {
+		ev.onBranch(node, cond)
+	}
+	if cond {
+		err = ev.evalBranch("then", node.Body)
+		ev.skipBranch("else", node.Else)
+	} else {
+		ev.skipBranch("then", node.Body)
+		err = ev.evalBranch("else", node.Else)
 	}
 	return nil, err
 }
 
-func (ruleNode *RuleNode) evalBlockStmt(node *ast.BlockStmt) (ret reflect.Value, err error) {
+// evalCondExpr : Get value of if or for condition, value other than bool, including nil of missing json key, is an error
+func (ev *evaluator) evalCondExpr(node ast.Expr) (bool, error) {
+	value, err := ev.getData(node)
+	if nil != err {
+		return false, err
+	}
+	cond, ok := value.(bool)
+	if !ok {
+		return false, scanner.ErrorList{{
+			Pos: ev.rulePosition(node.Pos()),
+			Msg: fmt.Sprintf("condition should be bool, not %T", value),
+		}}
+	}
+	return cond, nil
+}
+
+// evalBranch : Run body or else branch of if statement
+func (ev *evaluator) evalBranch(kind string, branch ast.Stmt) (err error) {
+	if nil == branch {
+		return
+	}
+	if nil != ev.explain {
+		explain := ev.explain.open(kind, "", ev.rulePosition(branch.Pos()))
+		defer func() {
+			ev.explain.close(explain, err)
+		}()
+	}
+	_, err = ev.eval(branch)
+	return
+}
+
+func (ev *evaluator) evalBlockStmt(node *ast.BlockStmt) (ret reflect.Value, err error) {
 	for _, stmt := range node.List {
-		_, err = ruleNode.eval(stmt)
+		_, err = ev.eval(stmt)
 		if nil != err {
 			return
 		}
@@ -203,9 +477,10 @@ func (ruleNode *RuleNode) evalBlockStmt(node *ast.BlockStmt) (ret reflect.Value,
 	return
 }
 
-func (ruleNode *RuleNode) evalCallExpr(node *ast.CallExpr) (ret []interface{}, err error) {
+func (ev *evaluator) evalCallExpr(node *ast.CallExpr) (ret []interface{}, err error) {
 	var vFunc reflect.Value
-	vFunc, err = ruleNode.getFunc(node)
+	var injectCtx bool
+	vFunc, injectCtx, err = ev.getFunc(node)
 	if nil != err {
 		return
 	}
@@ -221,8 +496,12 @@ func (ruleNode *RuleNode) evalCallExpr(node *ast.CallExpr) (ret []interface{}, e
 	}
 
 	nodeFunc, isSel := node.Fun.(*ast.SelectorExpr)
+	if isSel && ev.isPackageSel(nodeFunc) {
+		// package function, no receiver
+		isSel = false
+	}
 	realInNum := len(node.Args)
-	if isSel {
+	if isSel || injectCtx {
 		realInNum++
 	}
 	if !tFunc.IsVariadic() && realInNum != numIn {
@@ -231,14 +510,17 @@ func (ruleNode *RuleNode) evalCallExpr(node *ast.CallExpr) (ret []interface{}, e
 
 	args := make([]reflect.Value, 0, realInNum)
 	if isSel {
-		selStru, err := ruleNode.getData(nodeFunc.X)
+		selStru, err := ev.getData(nodeFunc.X)
 		if nil != err {
 			return ret, err
 		}
 		args = append(args, reflect.ValueOf(selStru))
 	}
+	if injectCtx {
+		args = append(args, reflect.ValueOf(ev.dataCtx))
+	}
 	for _, n := range node.Args {
-		paramInter, err := ruleNode.getData(n)
+		paramInter, err := ev.getData(n)
 		if nil != err {
 			return ret, fmt.Errorf("Get fun params error: %v", err)
 		}
@@ -260,19 +542,29 @@ func (ruleNode *RuleNode) evalCallExpr(node *ast.CallExpr) (ret []interface{}, e
 		args = append(args, param)
 	}
 
+	var start time.Time
+	if nil != ev.metrics {
+		start = time.Now()
+	}
 	for _, r := range vFunc.Call(args) {
 		ret = append(ret, r.Interface())
 	}
+	if nil != ev.metrics {
+		ev.metrics.sink.ObserveCall(ev.metricsName(), types.ExprString(node.Fun), time.Since(start))
+	}
+	if len(ev.hooks) > 0 {
+		ev.onCall(node, args[len(args)-len(node.Args):], ret)
+	}
 	// return vFunc.Call(args), nil
 	return
 }
 
-func (ruleNode *RuleNode) evalIdent(node *ast.Ident) (ret reflect.Value, err error) {
+func (ev *evaluator) evalIdent(node *ast.Ident) (ret reflect.Value, err error) {
 	return reflect.ValueOf(node.Name), nil
 }
 
-func (ruleNode *RuleNode) evalSelectorExpr(node *ast.SelectorExpr) (vFunc reflect.Value, err error) {
-	v, err := ruleNode.getData(node.X)
+func (ev *evaluator) evalSelectorExpr(node *ast.SelectorExpr) (vFunc reflect.Value, err error) {
+	v, err := ev.getData(node.X)
 	if nil != err {
 		return nilValue, err
 	}
@@ -288,14 +580,14 @@ func (ruleNode *RuleNode) evalSelectorExpr(node *ast.SelectorExpr) (vFunc reflec
 	return
 }
 
-func (ruleNode *RuleNode) evalIndexExpr(node *ast.IndexExpr) (ret reflect.Value, err error) {
+func (ev *evaluator) evalIndexExpr(node *ast.IndexExpr) (ret reflect.Value, err error) {
 	return
 }
 
-func (ruleNode *RuleNode) evalForStmt(node *ast.ForStmt) (ret reflect.Value, err error) {
+func (ev *evaluator) evalForStmt(node *ast.ForStmt) (ret reflect.Value, err error) {
 	// init loop
 	if nil != node.Init {
-		_, err = ruleNode.eval(node.Init)
+		_, err = ev.eval(node.Init)
 		if nil != err {
 			return
 		}
@@ -306,17 +598,17 @@ func (ruleNode *RuleNode) evalForStmt(node *ast.ForStmt) (ret reflect.Value, err
 		return
 	}
 
-	var cond interface{}
+	var cond bool
 	for {
-		cond, err = ruleNode.getData(node.Cond)
+		cond, err = ev.evalCondExpr(node.Cond)
 		if nil != err {
 			return nilValue, err
 		}
-		if !cond.(bool) {
+		if !cond {
 			return
 		}
 
-		_, err = ruleNode.eval(node.Body)
+		_, err = ev.eval(node.Body)
 		if nil != err {
 			switch err.Error() {
 			case TOKEN_BREAK:
@@ -331,7 +623,7 @@ func (ruleNode *RuleNode) evalForStmt(node *ast.ForStmt) (ret reflect.Value, err
 		}
 
 		if nil != node.Post {
-			_, err = ruleNode.eval(node.Post)
+			_, err = ev.eval(node.Post)
 			if nil != err {
 				return
 			}
@@ -339,26 +631,90 @@ func (ruleNode *RuleNode) evalForStmt(node *ast.ForStmt) (ret reflect.Value, err
 	}
 }
 
-func (ruleNode *RuleNode) evalIncDecStmt(node *ast.IncDecStmt) (ret reflect.Value, err error) {
-	x, err := ruleNode.getData(node.X)
+// evalRangeStmt : Range over string by rune, slice and array by index
+func (ev *evaluator) evalRangeStmt(node *ast.RangeStmt) (ret reflect.Value, err error) {
+	x, err := ev.getData(node.X)
+	if nil != err {
+		return
+	}
+	xPath := ev.lastPath
+
+	// step run body with one element, stop is true if loop breaks
+	step := func(key interface{}, value interface{}) (stop bool, err error) {
+		for _, elem := range []struct {
+			expr ast.Expr
+			v    interface{}
+			path string
+		}{{node.Key, key, ""}, {node.Value, value, joinPath(xPath, indexPath(key))}} {
+			if ident, ok := elem.expr.(*ast.Ident); nil == elem.expr || ok && "_" == ident.Name {
+				continue
+			}
+			if err = ev.setData(elem.expr, reflect.ValueOf(elem.v), node.Tok); nil != err {
+				return true, err
+			}
+			ev.trackAlias(elem.expr, node.X, elem.path, elem.v)
+		}
+		if _, err = ev.eval(node.Body); nil != err {
+			switch err.Error() {
+			case TOKEN_BREAK:
+				return true, nil
+			case TOKEN_CONTINUE:
+				return false, nil
+			}
+			return true, err
+		}
+		return false, nil
+	}
+
+	v := derefValue(reflect.ValueOf(x))
+	stop := false
+	switch v.Kind() {
+	case reflect.String:
+		for i, r := range v.String() {
+			if stop, err = step(i, r); stop {
+				break
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len() && !stop; i++ {
+			stop, err = step(i, v.Index(i).Interface())
+		}
+	default:
+		return nilValue, fmt.Errorf("Can not range over %T", ptrElem(x))
+	}
+	return nilValue, err
+}
+
+func (ev *evaluator) evalIncDecStmt(node *ast.IncDecStmt) (ret reflect.Value, err error) {
+	x, err := ev.getData(node.X)
 	if nil != err {
 		return nilValue, err
 	}
 
 	switch node.Tok.String() {
 	case "++", "--":
-		v, err := doNumMath(x, 0, node.Tok.String())
+		var v interface{}
+		if d, ok := ptrElem(x).(time.Duration); ok {
+			// duration step is one nanosecond
+			op := token.ADD
+			if token.DEC == node.Tok {
+				op = token.SUB
+			}
+			v, err = durationMath(d, reflect.ValueOf(1), op)
+		} else {
+			v, err = doNumMath(x, 0, node.Tok.String())
+		}
 		if nil != err {
 			return nilValue, err
 		}
 
-		err = ruleNode.setData(node.X, reflect.ValueOf(v), token.ASSIGN)
+		err = ev.setData(node.X, reflect.ValueOf(v), token.ASSIGN)
 		return nilValue, err
 	}
 	return nilValue, errors.New("Operate not define")
 }
 
-func (ruleNode *RuleNode) evalBranchStmt(node *ast.BranchStmt) (ret reflect.Value, err error) {
+func (ev *evaluator) evalBranchStmt(node *ast.BranchStmt) (ret reflect.Value, err error) {
 	switch node.Tok {
 	case token.BREAK:
 		err = errors.New(TOKEN_BREAK)
@@ -370,7 +726,34 @@ func (ruleNode *RuleNode) evalBranchStmt(node *ast.BranchStmt) (ret reflect.Valu
 	return
 }
 
-func (ruleNode *RuleNode) evalCompositeLit(node *ast.CompositeLit) (slice interface{}, err error) {
+// evalReturnStmt : Keep copy of return values, and stop eval by TOKEN_RETURN
+func (ev *evaluator) evalReturnStmt(node *ast.ReturnStmt) (err error) {
+	result := []interface{}{}
+	var call *ast.CallExpr
+	if 1 == len(node.Results) {
+		call, _ = node.Results[0].(*ast.CallExpr)
+	}
+	if nil != call {
+		// `return f()` return all results of f
+		result, err = ev.evalCallExpr(call)
+		if nil != err {
+			return
+		}
+	} else {
+		for _, expr := range node.Results {
+			var value interface{}
+			value, err = ev.getData(expr)
+			if nil != err {
+				return
+			}
+			result = append(result, elemCopy(value))
+		}
+	}
+	ev.result = result
+	return errors.New(TOKEN_RETURN)
+}
+
+func (ev *evaluator) evalCompositeLit(node *ast.CompositeLit) (slice interface{}, err error) {
 	switch n := node.Type.(type) {
 	case *ast.ArrayType:
 		ident, ok := n.Elt.(*ast.Ident)
@@ -384,7 +767,7 @@ func (ruleNode *RuleNode) evalCompositeLit(node *ast.CompositeLit) (slice interf
 		case "int":
 			s := make([]int, length, length)
 			for i, expr := range node.Elts {
-				elem, err := ruleNode.getData(expr)
+				elem, err := ev.getData(expr)
 				if nil != err {
 					return nilValue, err
 				}
@@ -395,7 +778,7 @@ func (ruleNode *RuleNode) evalCompositeLit(node *ast.CompositeLit) (slice interf
 		case "string":
 			s := make([]string, length, length)
 			for i, expr := range node.Elts {
-				elem, err := ruleNode.getData(expr)
+				elem, err := ev.getData(expr)
 				if nil != err {
 					return nilValue, err
 				}
@@ -406,7 +789,7 @@ func (ruleNode *RuleNode) evalCompositeLit(node *ast.CompositeLit) (slice interf
 		case "float32":
 			s := make([]float32, length, length)
 			for i, expr := range node.Elts {
-				elem, err := ruleNode.getData(expr)
+				elem, err := ev.getData(expr)
 				if nil != err {
 					return nilValue, err
 				}
@@ -417,7 +800,7 @@ func (ruleNode *RuleNode) evalCompositeLit(node *ast.CompositeLit) (slice interf
 		case "float64":
 			s := make([]float64, length, length)
 			for i, expr := range node.Elts {
-				elem, err := ruleNode.getData(expr)
+				elem, err := ev.getData(expr)
 				if nil != err {
 					return nilValue, err
 				}
@@ -457,42 +840,76 @@ func (ruleNode *RuleNode) evalMapType(node *ast.MapType) (param interface{}, err
 	return makeMapParam{tKey: tKey, tValue: tValue}, nil
 }
 
-func (ruleNode *RuleNode) getData(node ast.Expr) (ret interface{}, err error) {
+func (ev *evaluator) getData(node ast.Expr) (ret interface{}, err error) {
 	switch n := node.(type) {
 	case *ast.Ident:
-		ret, err = ruleNode.identGet(n)
+		ret, err = ev.identGet(n)
+		if ev.tracking() {
+			path, ok := ev.aliases[n.Name]
+			if !ok {
+				path = identPath(n)
+			}
+			ev.traceRead(path)
+		}
 
 	case *ast.IndexExpr:
 		var x, index interface{}
-		x, err = ruleNode.getData(n.X)
+		x, err = ev.getData(n.X)
 		if nil != err {
 			return x, err
 		}
-		index, err := ruleNode.getData(n.Index)
+		xPath := ev.lastPath
+		index, err = ev.getData(n.Index)
 		if nil != err {
 			return index, err
 		}
 		ret, err = getDataByIndex(x, index)
+		if ev.tracking() {
+			ev.traceRead(joinPath(xPath, indexPath(index)))
+		}
 
 	case *ast.SelectorExpr:
+		if ev.isPackageSel(n) {
+			// constant of package, like `time.Hour`
+			if err = ev.checkDataCollision(n); nil != err {
+				return
+			}
+			ret, err = ev.packageMember(n)
+			ev.lastPath = ""
+			break
+		}
 		var x interface{}
-		x, err = ruleNode.getData(n.X)
+		x, err = ev.getData(n.X)
 		if nil != err {
 			return nil, err
 		}
-		ret, err = getDataBySel(x, n.Sel.Name)
+		if isMapData(x) {
+			// `m.key` is sugar of `m["key"]` on map
+			ret, err = getDataByIndex(x, n.Sel.Name)
+		} else {
+			ret, err = getDataBySel(x, n.Sel.Name)
+		}
+		if ev.tracking() {
+			ev.traceRead(joinPath(ev.lastPath, "."+n.Sel.Name))
+		}
+
+	case *ast.SliceExpr:
+		ret, err = ev.evalSliceExpr(n)
 
 	case *ast.BasicLit:
-		ret, err = ruleNode.evalBasicLit(n)
+		ret, err = ev.evalBasicLit(n)
 
 	case *ast.BinaryExpr:
-		ret, err = ruleNode.evalBinaryExpr(n)
+		ret, err = ev.evalBinaryExpr(n)
+
+	case *ast.UnaryExpr:
+		ret, err = ev.evalUnaryExpr(n)
 
 	case *ast.ParenExpr:
-		ret, err = ruleNode.getData(n.X)
+		return ev.getData(n.X)
 
 	case *ast.CallExpr:
-		ret, err = ruleNode.evalCallExpr(n)
+		ret, err = ev.evalCallExpr(n)
 		retList := ret.([]interface{})
 		if len(retList) > 0 {
 			ret = retList[0]
@@ -501,18 +918,29 @@ func (ruleNode *RuleNode) getData(node ast.Expr) (ret interface{}, err error) {
 		}
 
 	case *ast.CompositeLit:
-		return ruleNode.evalCompositeLit(n)
+		ret, err = ev.evalCompositeLit(n)
 	case *ast.MapType:
-		return ruleNode.evalMapType(n)
+		ret, err = ev.evalMapType(n)
 	default:
 		err = fmt.Errorf("Unexpect get node type: %T, value: %v", node, node)
 		return
 	}
 
+	if ev.tracking() {
+		switch node.(type) {
+		case *ast.Ident, *ast.IndexExpr, *ast.SelectorExpr:
+		default:
+			// value is not come from a variable
+			ev.lastPath = ""
+		}
+	}
+	if nil == err && len(ev.hooks) > 0 {
+		ev.afterExpr(node, ret)
+	}
 	return
 }
 
-func (ruleNode *RuleNode) identGet(node *ast.Ident) (value interface{}, err error) {
+func (ev *evaluator) identGet(node *ast.Ident) (value interface{}, err error) {
 	switch node.Name {
 	case "true":
 		value = true
@@ -521,12 +949,17 @@ func (ruleNode *RuleNode) identGet(node *ast.Ident) (value interface{}, err erro
 	case "nil":
 		value = nil
 	default:
-		value, err = ruleNode.dataCtx.Get(node.Name)
+		value, err = ev.dataCtx.Get(node.Name)
 	}
 	return
 }
 
 func getDataByIndex(data interface{}, index interface{}) (ret interface{}, err error) {
+	if nil == data {
+		// nil come from missing key, index on it is nil as well
+		return nil, nil
+	}
+	index = ptrElem(index)
 	tData := reflect.TypeOf(data)
 	kData := tData.Kind()
 
@@ -548,21 +981,46 @@ func getDataByIndex(data interface{}, index interface{}) (ret interface{}, err e
 
 	switch kData {
 	case reflect.Map:
+		var vKey reflect.Value
+		vKey, err = mapKey(index, tData.Key())
+		if nil != err {
+			return
+		}
+		if !reflect.ValueOf(data).Elem().MapIndex(vKey).IsValid() {
+			// missing key is nil instead of zero value, so that it can be checked
+			return nil, nil
+		}
+		key := reflect.New(tData.Key())
+		key.Elem().Set(vKey)
 		tMap := reflect2.Type2(tData).(reflect2.MapType)
-		kKey := reflect.TypeOf(index).Kind()
-		if reflect.Ptr == kKey {
-			key := index.(*string)
-			ret = tMap.GetIndex(data, key)
-		} else {
-			key := index.(string)
-			ret = tMap.GetIndex(data, &key)
+		ret = ptrElem(tMap.GetIndex(data, key.Interface()))
+
+	case reflect.String:
+		// like Go, index of string is byte
+		var i int
+		if i, err = toIndex(index); nil != err {
+			return
 		}
-		ret = ptrElem(ret)
+		str := reflect.ValueOf(data).Elem().String()
+		if i < 0 || i >= len(str) {
+			return nil, fmt.Errorf("String index out of range: %d", i)
+		}
+		ret = str[i]
 
 	case reflect.Slice:
+		var i int
+		if i, err = toIndex(index); nil != err {
+			return
+		}
+		if i < 0 || i >= reflect.ValueOf(data).Elem().Len() {
+			return nil, fmt.Errorf("Slice index out of range: %d", i)
+		}
 		tSlice := reflect2.Type2(tData).(reflect2.SliceType)
-		ret = tSlice.GetIndex(data, index.(int))
-		ret = ptrElem(ret)
+		ret = tSlice.GetIndex(data, i)
+		if reflect.Struct != tData.Elem().Kind() {
+			// keep ptr of struct element so that it's field can be updated
+			ret = ptrElem(ret)
+		}
 
 	default:
 		err = fmt.Errorf("Unexpect data kind when get by index: %v", kData)
@@ -571,41 +1029,179 @@ func getDataByIndex(data interface{}, index interface{}) (ret interface{}, err e
 	return
 }
 
+// toIndex : Index should be integer, float from math is allowed if it has no fraction
+func toIndex(index interface{}) (int, error) {
+	vIndex := reflect.ValueOf(index)
+	if isNumberValue(vIndex) {
+		f := numFloat(vIndex)
+		if f == float64(int(f)) {
+			return int(f), nil
+		}
+	}
+	return 0, fmt.Errorf("Index should be integer, not %T(%v)", index, index)
+}
+
+// evalSliceExpr : Slice string, slice and array like Go, slice of string is byte based
+func (ev *evaluator) evalSliceExpr(node *ast.SliceExpr) (ret interface{}, err error) {
+	x, err := ev.getData(node.X)
+	if nil != err {
+		return
+	}
+	v := derefValue(reflect.ValueOf(x))
+	var capacity int
+	switch v.Kind() {
+	case reflect.String:
+		if node.Slice3 {
+			return nil, fmt.Errorf("Can not use 3-index slice on string")
+		}
+		capacity = v.Len()
+	case reflect.Slice, reflect.Array:
+		capacity = v.Cap()
+	default:
+		return nil, fmt.Errorf("Can not slice %T", ptrElem(x))
+	}
+
+	bounds := []int{0, v.Len(), capacity}
+	for i, expr := range []ast.Expr{node.Low, node.High, node.Max} {
+		if nil == expr {
+			continue
+		}
+		var bound interface{}
+		if bound, err = ev.getData(expr); nil != err {
+			return
+		}
+		if bounds[i], err = toIndex(ptrElem(bound)); nil != err {
+			return
+		}
+	}
+	low, high, max := bounds[0], bounds[1], bounds[2]
+	if low < 0 || low > high || high > max || max > capacity {
+		return nil, fmt.Errorf("Slice bounds out of range [%d:%d] with capacity %d", low, high, capacity)
+	}
+
+	switch {
+	case reflect.String == v.Kind():
+		return v.String()[low:high], nil
+	case reflect.Array == v.Kind() && !v.CanAddr():
+		array := reflect.New(v.Type()).Elem()
+		array.Set(v)
+		v = array
+	}
+	if node.Slice3 {
+		return v.Slice3(low, high, max).Interface(), nil
+	}
+	return v.Slice(low, high).Interface(), nil
+}
+
+// mapKey : Convert index to key type of map, number can be used as key of any number type
+func mapKey(index interface{}, tKey reflect.Type) (reflect.Value, error) {
+	vKey := reflect.ValueOf(index)
+	switch {
+	case !vKey.IsValid():
+		return vKey, fmt.Errorf("Map key should not be nil")
+	case vKey.Type().AssignableTo(tKey):
+		return vKey, nil
+	case IsNumber(vKey.Kind()) && IsNumber(tKey.Kind()):
+		return vKey.Convert(tKey), nil
+	}
+	return vKey, fmt.Errorf("Map key type not match, key type: %v, index type: %T", tKey, index)
+}
+
+// isMapData : Check if data is map or ptr to map
+func isMapData(data interface{}) bool {
+	return reflect.Map == derefValue(reflect.ValueOf(data)).Kind()
+}
+
 func getDataBySel(data interface{}, field string) (ret interface{}, err error) {
+	if nil == data {
+		return nil, nil
+	}
 	tData := reflect2.TypeOf(data)
 	_, ok := tData.(reflect2.PtrType)
 	if ok {
 		tData = reflect2.Type2(tData.Type1().Elem())
+	} else if nil != data {
+		data = valuePtr(data)
 	}
-	tStruct := tData.(reflect2.StructType)
-	return tStruct.FieldByName(field).Get(data), nil
+	tStruct, ok := tData.(reflect2.StructType)
+	if !ok {
+		return nil, fmt.Errorf("Unexpect data kind when get by sel, type: %T", data)
+	}
+	structField := tStruct.FieldByName(field)
+	if nil == structField {
+		return nil, fmt.Errorf("Field %s not found", field)
+	}
+	return structField.Get(data), nil
 }
 
-func (ruleNode *RuleNode) setData(node ast.Expr, value reflect.Value, t token.Token) (err error) {
+func (ev *evaluator) setData(node ast.Expr, value reflect.Value, t token.Token) (err error) {
 	var elem interface{}
 	switch n := node.(type) {
 	case *ast.Ident:
-		err = ruleNode.identSet(n, value, t)
+		err = ev.identSet(n, value, t)
+		if nil == err && ev.tracking() {
+			ev.traceWrite(identPath(n))
+		}
 	case *ast.IndexExpr:
-		elem, err = ruleNode.getData(n.X)
+		ev.shadow(n)
+		elem, err = ev.getData(n.X)
 		if nil != err {
 			return
 		}
+		if err = ev.checkWritable(n); nil != err {
+			return
+		}
+		xPath := ev.lastPath
 		var index interface{}
-		index, err = ruleNode.getData(n.Index)
+		index, err = ev.getData(n.Index)
 		if nil != err {
 			return
 		}
 
+		path := joinPath(xPath, indexPath(index))
+		if nil != ev.undoLog {
+			if "" == path {
+				path = types.ExprString(n.X) + indexPath(index)
+			}
+			ev.undoLog.recordIndex(path, reflect.ValueOf(elem), reflect.ValueOf(index), value)
+		}
 		err = setDataByIndex(reflect.ValueOf(elem), reflect.ValueOf(index), value)
+		if nil == err && ev.tracking() {
+			ev.traceWrite(path)
+		}
 
 	case *ast.SelectorExpr:
-		elem, err = ruleNode.getData(n.X)
+		ev.shadow(n)
+		elem, err = ev.getData(n.X)
 		if nil != err {
 			return
 		}
+		if err = ev.checkWritable(n); nil != err {
+			return
+		}
 
-		err = setDataBySel(reflect.ValueOf(elem), n.Sel.Name, value)
+		path := joinPath(ev.lastPath, "."+n.Sel.Name)
+		isMap := isMapData(elem)
+		if nil != ev.undoLog {
+			undoPath := path
+			if "" == undoPath {
+				undoPath = types.ExprString(n)
+			}
+			if isMap {
+				ev.undoLog.recordIndex(undoPath, reflect.ValueOf(elem), reflect.ValueOf(n.Sel.Name), value)
+			} else {
+				ev.undoLog.recordSel(undoPath, reflect.ValueOf(elem), n.Sel.Name, value)
+			}
+		}
+		if isMap {
+			// `m.key = v` is sugar of `m["key"] = v` on map
+			err = setDataByIndex(reflect.ValueOf(elem), reflect.ValueOf(n.Sel.Name), value)
+		} else {
+			err = setDataBySel(reflect.ValueOf(elem), n.Sel.Name, value)
+		}
+		if nil == err && ev.tracking() {
+			ev.traceWrite(path)
+		}
 
 	default:
 		err = fmt.Errorf("Unexpect set node type: %T, value: %v", node, node)
@@ -613,7 +1209,96 @@ func (ruleNode *RuleNode) setData(node ast.Expr, value reflect.Value, t token.To
 	return
 }
 
-func (ruleNode *RuleNode) identSet(node *ast.Ident, value reflect.Value, t token.Token) (err error) {
+// checkWritable : Nested write like `a.b["c"] = 1` is not allowed if root variable `a` is read only
+func (ev *evaluator) checkWritable(node ast.Expr) error {
+	root := rootIdent(node)
+	if nil == root {
+		return nil
+	}
+	if err := ev.dataCtx.checkWritable(root.Name); nil != err {
+		return err
+	}
+	if source := ev.dataCtx.aliasOf(root.Name); "" != source {
+		return fmt.Errorf("Permission denied, variable '%s' share data with read only variable '%s'", root.Name, source)
+	}
+	return nil
+}
+
+// trackAlias : Variable assigned from read only data may share memory with it, like `m := headers`,
+// nested writes through the variable are denied as well. When tracking, path of the data local variable
+// share memory with is kept, so writes through it are traced and recorded under that path
+func (ev *evaluator) trackAlias(lhs ast.Expr, rhs ast.Expr, path string, value interface{}) {
+	ident, ok := lhs.(*ast.Ident)
+	if !ok {
+		return
+	}
+	if ev.tracking() {
+		ev.trackPath(ident.Name, path, value)
+	}
+	source := ""
+	if root := rootIdent(rhs); nil != root && sharesMemory(reflect.ValueOf(ptrElem(value))) {
+		if nil != ev.dataCtx.checkWritable(root.Name) {
+			source = root.Name
+		} else {
+			source = ev.dataCtx.aliasOf(root.Name)
+		}
+	}
+	if "" != source || nil != ev.dataCtx.aliases {
+		ev.dataCtx.setAlias(ident.Name, source)
+	}
+}
+
+// trackPath : Remember path of bound data local variable name share memory with, path of local is forgotten
+// when it is assigned with other value
+func (ev *evaluator) trackPath(name string, path string, value interface{}) {
+	if nil == ev.locals {
+		ev.locals = ev.RuleNode.locals()
+	}
+	if !ev.locals[name] {
+		return
+	}
+	if "" == path || ev.locals[pathRoot(path)] || !sharesMemory(reflect.ValueOf(ptrElem(value))) {
+		delete(ev.aliases, name)
+		return
+	}
+	if nil == ev.aliases {
+		ev.aliases = make(map[string]string)
+	}
+	ev.aliases[name] = path
+}
+
+// shadow : Copy root variable of nested write from parent context, so the write do not reach the parent
+func (ev *evaluator) shadow(node ast.Expr) {
+	root := rootIdent(node)
+	if nil == root || !ev.dataCtx.shadow(root.Name) {
+		return
+	}
+	if nil != ev.undoLog {
+		ev.undoLog.recordShadow(ev.dataCtx, root.Name)
+	}
+}
+
+// rootIdent : Get the variable that an index or selector expression start from
+func rootIdent(node ast.Expr) *ast.Ident {
+	for {
+		switch n := node.(type) {
+		case *ast.Ident:
+			return n
+		case *ast.IndexExpr:
+			node = n.X
+		case *ast.SelectorExpr:
+			node = n.X
+		case *ast.SliceExpr:
+			node = n.X
+		case *ast.ParenExpr:
+			node = n.X
+		default:
+			return nil
+		}
+	}
+}
+
+func (ev *evaluator) identSet(node *ast.Ident, value reflect.Value, t token.Token) (err error) {
 	switch node.Name {
 	case "true":
 		err = fmt.Errorf("Can not set to true")
@@ -622,19 +1307,47 @@ func (ruleNode *RuleNode) identSet(node *ast.Ident, value reflect.Value, t token
 	case "nil":
 		err = fmt.Errorf("Can not set to nil")
 	default:
-		err = ruleNode.dataCtx.Set(node.Name, value)
+		if nil != ev.undoLog && nil == ev.dataCtx.checkWritable(node.Name) {
+			ev.undoLog.recordIdent(ev.dataCtx, node.Name, value)
+		}
+		err = ev.dataCtx.Set(node.Name, value)
 	}
 	return
 }
 
-func (ruleNode *RuleNode) getFunc(node *ast.CallExpr) (vFunc reflect.Value, err error) {
+// getFunc : Get function called by node, injectCtx is true if it is bound by BindWithContext
+func (ev *evaluator) getFunc(node *ast.CallExpr) (vFunc reflect.Value, injectCtx bool, err error) {
 	switch n := node.Fun.(type) {
 	case *ast.SelectorExpr:
-		vFunc, err = ruleNode.eval(n)
+		if ev.isPackageSel(n) {
+			if err = ev.checkDataCollision(n); nil != err {
+				return
+			}
+			pkgName := n.X.(*ast.Ident).Name
+			pkg, _ := ev.funcCtx.getPackage(pkgName)
+			fun, ok := pkg[n.Sel.Name]
+			if !ok {
+				err = fmt.Errorf("Call udf fail, udf not found: %s.%s", pkgName, n.Sel.Name)
+				return
+			}
+			if cf, ok := fun.(ctxFunc); ok {
+				fun, injectCtx = cf.fun, true
+			}
+			if reflect.Func != reflect.TypeOf(fun).Kind() {
+				err = fmt.Errorf("Call udf fail, %s.%s is not func", pkgName, n.Sel.Name)
+				return
+			}
+			vFunc = reflect.ValueOf(fun)
+			return
+		}
+		vFunc, err = ev.eval(n)
 
 	case *ast.Ident:
 		funName := n.Name
-		udf, ok := ruleNode.funcCtx.data[funName]
+		udf, ok := ev.funcCtx.lookup(funName)
+		if cf, isCtxFunc := udf.(ctxFunc); isCtxFunc {
+			udf, injectCtx = cf.fun, true
+		}
 		if ok {
 			vFunc = reflect.ValueOf(udf)
 		} else {
@@ -648,12 +1361,40 @@ func (ruleNode *RuleNode) getFunc(node *ast.CallExpr) (vFunc reflect.Value, err
 	return
 }
 
+// packageMember : Get member of bound package
+func (ruleNode *RuleNode) packageMember(node *ast.SelectorExpr) (interface{}, error) {
+	pkgName := node.X.(*ast.Ident).Name
+	pkg, _ := ruleNode.funcCtx.getPackage(pkgName)
+	member, ok := pkg[node.Sel.Name]
+	if !ok {
+		return nil, fmt.Errorf("Package member not found: %s.%s", pkgName, node.Sel.Name)
+	}
+	return member, nil
+}
+
+// checkDataCollision : Data variable with the name of a package can not be reached by rule, report it
+// instead of silently using the package
+func (ev *evaluator) checkDataCollision(node *ast.SelectorExpr) error {
+	name := node.X.(*ast.Ident).Name
+	if _, _, ok := ev.dataCtx.lookup(name); ok || ev.dataCtx.isComputed(name) {
+		return fmt.Errorf("Variable '%s' collides with package '%s'", name, name)
+	}
+	return nil
+}
+
+// isPackageSel : Check if selector is `pkg.Member` of a bound package, package names take precedence over data
+func (ruleNode *RuleNode) isPackageSel(node *ast.SelectorExpr) bool {
+	ident, ok := node.X.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	_, ok = ruleNode.funcCtx.getPackage(ident.Name)
+	return ok
+}
+
 func setDataByIndex(vData reflect.Value, vIndex reflect.Value, vValue reflect.Value) (err error) {
+	vData = derefValue(vData)
 	kData := vData.Kind()
-	for reflect.Ptr == kData || reflect.Interface == kData {
-		vData = vData.Elem()
-		kData = vData.Kind()
-	}
 
 	switch kData {
 	case reflect.Map:
@@ -669,11 +1410,8 @@ func setDataByIndex(vData reflect.Value, vIndex reflect.Value, vValue reflect.Va
 }
 
 func setDataBySel(vData reflect.Value, field string, vValue reflect.Value) (err error) {
+	vData = derefValue(vData)
 	kData := vData.Kind()
-	for reflect.Ptr == kData || reflect.Interface == kData {
-		vData = vData.Elem()
-		kData = vData.Kind()
-	}
 	if reflect.Struct != kData {
 		return fmt.Errorf("Unexpect data kind when set by sel, type: %T, value: %v", vData.Type(), vData)
 	}
@@ -710,6 +1448,13 @@ func getInterfaceRealType(vValue reflect.Value) reflect.Type {
 }
 
 func typeConvert(vValue reflect.Value, targetType reflect.Type) (reflect.Value, error) {
+	if !vValue.IsValid() {
+		switch targetType.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+			return reflect.Zero(targetType), nil
+		}
+		return vValue, fmt.Errorf("Can not set nil to %v", targetType)
+	}
 	tValue := vValue.Type()
 	if targetType == tValue {
 		return vValue, nil
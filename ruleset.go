@@ -0,0 +1,207 @@
+package geval
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RuleSet : Immutable snapshot of loaded rules, entries are sorted by priority from high to low
+type RuleSet struct {
+	version  int
+	checksum string
+	loadedAt time.Time
+	entries  []*RuleEntry
+	byName   map[string]*RuleEntry
+}
+
+// RuleWatcher : Hold current RuleSet of a rule directory, and replace it atomically when files change.
+// A new set is swapped in only if all rules in it compile, otherwise the previous set is kept
+type RuleWatcher struct {
+	fsys    fs.FS
+	funcCtx *FunContext
+	current atomic.Value
+	// mu make reload serial
+	mu     sync.Mutex
+	stop   chan struct{}
+	onSwap func(old *RuleSet, new *RuleSet)
+}
+
+// NewRuleSet : Build set from loaded entries
+func NewRuleSet(entries []*RuleEntry) *RuleSet {
+	set := &RuleSet{
+		loadedAt: time.Now(),
+		entries:  append([]*RuleEntry{}, entries...),
+		byName:   make(map[string]*RuleEntry),
+	}
+	sort.SliceStable(set.entries, func(i, j int) bool {
+		return set.entries[i].Priority > set.entries[j].Priority
+	})
+	for _, entry := range set.entries {
+		set.byName[entry.Name] = entry
+	}
+	return set
+}
+
+// Version : Version of set, start from 1 and increase on every swap of watcher
+func (set *RuleSet) Version() int {
+	return set.version
+}
+
+// Checksum : Checksum of rule files the set is loaded from
+func (set *RuleSet) Checksum() string {
+	return set.checksum
+}
+
+// LoadedAt : Time set is loaded
+func (set *RuleSet) LoadedAt() time.Time {
+	return set.loadedAt
+}
+
+// Rules : All rules in set, include disabled ones
+func (set *RuleSet) Rules() []*RuleEntry {
+	return set.entries
+}
+
+// Get : Get rule by name
+func (set *RuleSet) Get(name string) (*RuleEntry, bool) {
+	entry, ok := set.byName[name]
+	return entry, ok
+}
+
+// Eval : Run enabled rules in priority order, stop at first error. It can be called by many goroutines
+// at the same time with different DataContext
+func (set *RuleSet) Eval(dataCtx *DataContext) error {
+	for _, entry := range set.entries {
+		if !entry.Enabled {
+			continue
+		}
+		if err := entry.Node.Eval(dataCtx); nil != err {
+			return fmt.Errorf("Rule %s: %v", entry.Name, err)
+		}
+	}
+	return nil
+}
+
+// NewRuleWatcher : Load rules from fsys, fail if the first load fail
+func NewRuleWatcher(fsys fs.FS, funcCtx *FunContext) (*RuleWatcher, error) {
+	watcher := &RuleWatcher{fsys: fsys, funcCtx: funcCtx}
+	if _, err := watcher.Reload(); nil != err {
+		return nil, err
+	}
+	return watcher, nil
+}
+
+// Current : Get current rule set, the set is never changed after returned, keep it during an
+// evaluation to see the same rules
+func (watcher *RuleWatcher) Current() *RuleSet {
+	return watcher.current.Load().(*RuleSet)
+}
+
+// OnSwap : Set callback called after a new set is swapped in
+func (watcher *RuleWatcher) OnSwap(fun func(old *RuleSet, new *RuleSet)) {
+	watcher.mu.Lock()
+	defer watcher.mu.Unlock()
+	watcher.onSwap = fun
+}
+
+// Reload : Load rules if files changed. Return true if a new set is swapped in,
+// if load fail the error is returned and current set is kept
+func (watcher *RuleWatcher) Reload() (bool, error) {
+	watcher.mu.Lock()
+	defer watcher.mu.Unlock()
+
+	checksum, err := ruleChecksum(watcher.fsys)
+	if nil != err {
+		return false, err
+	}
+	old, _ := watcher.current.Load().(*RuleSet)
+	if nil != old && old.checksum == checksum {
+		return false, nil
+	}
+
+	entries, err := LoadRules(watcher.fsys, watcher.funcCtx)
+	if nil != err {
+		return false, err
+	}
+	set := NewRuleSet(entries)
+	set.checksum = checksum
+	set.version = 1
+	if nil != old {
+		set.version = old.version + 1
+	}
+	watcher.current.Store(set)
+
+	if nil != old && nil != watcher.onSwap {
+		watcher.onSwap(old, set)
+	}
+	return true, nil
+}
+
+// Watch : Poll files every interval and reload when they change, onError is called when reload fail.
+// Call Stop to end watching
+func (watcher *RuleWatcher) Watch(interval time.Duration, onError func(error)) {
+	watcher.mu.Lock()
+	if nil != watcher.stop {
+		watcher.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	watcher.stop = stop
+	watcher.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if _, err := watcher.Reload(); nil != err && nil != onError {
+					onError(err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop : Stop watching started by Watch
+func (watcher *RuleWatcher) Stop() {
+	watcher.mu.Lock()
+	defer watcher.mu.Unlock()
+	if nil != watcher.stop {
+		close(watcher.stop)
+		watcher.stop = nil
+	}
+}
+
+// ruleChecksum : Checksum of manifest and rule files in fsys
+func ruleChecksum(fsys fs.FS) (string, error) {
+	hash := sha256.New()
+	err := fs.WalkDir(fsys, ".", func(file string, d fs.DirEntry, err error) error {
+		if nil != err {
+			return err
+		}
+		if d.IsDir() || (RuleExt != path.Ext(file) && RuleManifest != file) {
+			return nil
+		}
+		data, err := fs.ReadFile(fsys, file)
+		if nil != err {
+			return err
+		}
+		fmt.Fprintf(hash, "%s\x00%d\x00", file, len(data))
+		hash.Write(data)
+		return nil
+	})
+	if nil != err {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
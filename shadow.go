@@ -0,0 +1,102 @@
+package geval
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ShadowReport : Result of a shadow eval. Primary is run on the live context, Candidate on a clone of it
+type ShadowReport struct {
+	PrimaryChanges   []Change
+	PrimaryResult    []interface{}
+	PrimaryErr       error
+	CandidateChanges []Change
+	CandidateResult  []interface{}
+	CandidateErr     error
+	Divergences      []Divergence
+}
+
+// Divergence : One difference between primary and candidate. Path is the written path, or `return` and `error`.
+// Value is nil if the side did not write the path
+type Divergence struct {
+	Path      string
+	Primary   interface{}
+	Candidate interface{}
+}
+
+// EvalShadow : Run primary on dataCtx and candidate on a deep clone of it taken before primary run.
+// Writes of candidate never reach the caller's data. Primary is run like Eval, writes made before it
+// fails are kept, and changes of both sides include writes made before they fail. Final values of written
+// paths, return values and errors are compared, onDiverge is called if they differ. Variables defined by
+// `:=` are not compared. Error of primary is returned, error of candidate is only reported
+func EvalShadow(primary *RuleNode, candidate *RuleNode, dataCtx *DataContext, onDiverge func(*ShadowReport)) (*ShadowReport, error) {
+	shadowCtx := dataCtx.Clone()
+	report := &ShadowReport{}
+
+	report.PrimaryChanges, report.PrimaryResult, report.PrimaryErr = primary.evalTx(dataCtx, false)
+	report.CandidateChanges, report.CandidateResult, report.CandidateErr = candidate.evalTx(shadowCtx, false)
+
+	report.diff(primary, candidate)
+	if len(report.Divergences) > 0 && nil != onDiverge {
+		onDiverge(report)
+	}
+	return report, report.PrimaryErr
+}
+
+func (report *ShadowReport) diff(primary *RuleNode, candidate *RuleNode) {
+	locals := primary.locals()
+	for name := range candidate.locals() {
+		locals[name] = true
+	}
+
+	paths := pathSet{}
+	primaryValues := finalValues(report.PrimaryChanges, locals, &paths)
+	candidateValues := finalValues(report.CandidateChanges, locals, &paths)
+	for _, path := range paths.list {
+		p, inPrimary := primaryValues[path]
+		c, inCandidate := candidateValues[path]
+		if inPrimary != inCandidate || !reflect.DeepEqual(p, c) {
+			report.Divergences = append(report.Divergences, Divergence{Path: path, Primary: p, Candidate: c})
+		}
+	}
+
+	if !reflect.DeepEqual(report.PrimaryResult, report.CandidateResult) {
+		report.Divergences = append(report.Divergences, Divergence{
+			Path:      "return",
+			Primary:   report.PrimaryResult,
+			Candidate: report.CandidateResult,
+		})
+	}
+	if errorText(report.PrimaryErr) != errorText(report.CandidateErr) {
+		report.Divergences = append(report.Divergences, Divergence{
+			Path:      "error",
+			Primary:   report.PrimaryErr,
+			Candidate: report.CandidateErr,
+		})
+	}
+}
+
+// finalValues : Last written value of each path, paths are added to set in write order
+func finalValues(changes []Change, locals map[string]bool, paths *pathSet) map[string]interface{} {
+	values := make(map[string]interface{})
+	for _, change := range changes {
+		if locals[pathRoot(change.Path)] {
+			continue
+		}
+		paths.add(change.Path)
+		values[change.Path] = change.New
+	}
+	return values
+}
+
+func errorText(err error) string {
+	if nil == err {
+		return ""
+	}
+	return err.Error()
+}
+
+// String : Format divergence like `dict["price"]: 10 != 12`
+func (d Divergence) String() string {
+	return fmt.Sprintf("%s: %v != %v", d.Path, d.Primary, d.Candidate)
+}
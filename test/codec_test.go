@@ -0,0 +1,138 @@
+package test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/MagicYH/geval"
+)
+
+func TestMarshalRuleNode(t *testing.T) {
+	rule := `a = Max(1, 2)
+dict["list"] = []int{1, 2}
+for i := 0; i < 3; i++ {
+	if i > 1 {
+		break
+	}
+	a = a + float64(i)
+}`
+	funCtx := geval.NewFunCtx()
+	funCtx.Bind("Max", math.Max)
+	funCtx.Bind("float64", func(i int) float64 { return float64(i) })
+
+	node, err := geval.NewRuleNode(rule, funCtx)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+	node.SetName("max.rule")
+
+	binData, err := node.MarshalBinary()
+	if nil != err {
+		t.Error("Marshal binary error: ", err)
+		return
+	}
+	jsonData, err := node.MarshalJSON()
+	if nil != err {
+		t.Error("Marshal json error: ", err)
+		return
+	}
+
+	for _, data := range [][]byte{binData, jsonData} {
+		loaded, err := geval.LoadRuleNode(data, funCtx)
+		if nil != err {
+			t.Error("Load rule error: ", err)
+			return
+		}
+		if loaded.Name() != "max.rule" || loaded.Checksum() != node.Checksum() {
+			t.Error("Loaded rule name or checksum error")
+			return
+		}
+
+		a := 0.0
+		dict := make(map[string]interface{})
+		dataCtx := geval.NewDataCtx()
+		dataCtx.Bind("a", &a)
+		dataCtx.Bind("dict", &dict)
+		explain, err := loaded.EvalExplain(dataCtx)
+		if nil != err {
+			t.Error("Eval loaded rule error: ", err)
+			return
+		}
+		if a != 3 || len(dict["list"].([]int)) != 2 {
+			t.Errorf("Result error, a: %v, dict: %v", a, dict)
+			return
+		}
+
+		a = 0
+		origin, _ := node.EvalExplain(dataCtx)
+		if origin.String() != explain.String() {
+			t.Errorf("Loaded rule positions error, expect:\n%s\nreal:\n%s", origin, explain)
+			return
+		}
+	}
+}
+
+func TestMarshalRangeAndSlice(t *testing.T) {
+	node, err := geval.NewRuleNode(`
+	sum := 0
+	for i, r := range s[1:] {
+		sum = sum + i
+		last = r
+	}
+	for _, v := range list[1:3] {
+		sum = sum + v
+	}
+	return sum, last`, nil)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+	data, err := node.MarshalBinary()
+	if nil != err {
+		t.Error("Marshal binary error: ", err)
+		return
+	}
+	loaded, err := geval.LoadRuleNode(data, nil)
+	if nil != err {
+		t.Error("Load rule error: ", err)
+		return
+	}
+
+	s, list, last := "abc", []int{1, 2, 3, 4}, 'x'
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("s", &s)
+	dataCtx.Bind("list", &list)
+	dataCtx.Bind("last", &last)
+	result, err := loaded.EvalResult(dataCtx)
+	if nil != err {
+		t.Error("Eval loaded rule error: ", err)
+		return
+	}
+	if result[0] != 6.0 || result[1] != 'c' {
+		t.Errorf("Result error: %v", result)
+	}
+}
+
+func TestLoadRuleNodeReject(t *testing.T) {
+	node, err := geval.NewRuleNode(`a = 1`, nil)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+	binData, _ := node.MarshalBinary()
+
+	version := append([]byte{}, binData...)
+	version[5]++
+	corrupt := append([]byte{}, binData...)
+	corrupt[10]++
+
+	for _, data := range [][]byte{version, corrupt, []byte("bad"), []byte(`{"version":99}`)} {
+		if _, err := geval.LoadRuleNode(data, nil); nil == err {
+			t.Errorf("Load should fail: %q", data)
+			return
+		} else {
+			t.Log(err)
+		}
+	}
+}
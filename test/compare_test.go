@@ -0,0 +1,119 @@
+package test
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/MagicYH/geval"
+)
+
+// Version : Version like `1.10.2`, compared by numbers
+type Version string
+
+func (v Version) Compare(other interface{}) (int, error) {
+	o, ok := other.(Version)
+	if !ok {
+		s, isStr := other.(string)
+		if !isStr {
+			return 0, fmt.Errorf("can not compare version with %T", other)
+		}
+		o = Version(s)
+	}
+	a, b := strings.Split(string(v), "."), strings.Split(string(o), ".")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		x, _ := strconv.Atoi(a[i])
+		y, _ := strconv.Atoi(b[i])
+		if x != y {
+			return x - y, nil
+		}
+	}
+	return len(a) - len(b), nil
+}
+
+// Grade : Ordered by rank, names are ignored
+type Grade struct {
+	Name string
+	Rank int
+}
+
+func (g *Grade) Less(other interface{}) bool {
+	return g.Rank < other.(Grade).Rank
+}
+
+func TestCompare(t *testing.T) {
+	i, i32, u8, f := 1, int32(5), uint8(200), 1.0
+	big1, big2 := int64(1<<53), int64(1<<53+1)
+	s := "apple"
+	p1, p2 := &Grade{Rank: 1}, &Grade{Rank: 1}
+	p3 := p1
+	v := Version("1.10.0")
+	low, high := Grade{"low", 1}, Grade{"high", 9}
+	var nilPtr *Grade
+	nan := math.NaN()
+
+	dataCtx := geval.NewDataCtx()
+	for name, data := range map[string]interface{}{
+		"i": &i, "i32": &i32, "u8": &u8, "f": &f, "big1": &big1, "big2": &big2, "s": &s,
+		"p1": &p1, "p2": &p2, "p3": &p3, "v": &v, "low": &low, "high": &high, "nilPtr": &nilPtr,
+		"nan": &nan,
+	} {
+		dataCtx.Bind(name, data)
+	}
+
+	cases := []struct {
+		expr   string
+		expect bool
+	}{
+		{`i == f`, true},
+		{`i32 == 5`, true},
+		{`i32 < u8`, true},
+		{`u8 > -1`, true},
+		{`big1 < big2`, true},
+		{`big1 == big2`, false},
+		{`s < "banana"`, true},
+		{`s >= "apple"`, true},
+		{`s == "apple"`, true},
+		{`p1 == p2`, false},
+		{`p1 == p3`, true},
+		{`p1 != nil`, true},
+		{`nilPtr == nil`, true},
+		{`v > "1.9.3"`, true},
+		{`v == "1.10"`, false},
+		{`"1.2" < v`, true},
+		{`low < high`, true},
+		{`low >= high`, false},
+		{`high > low`, true},
+		{`low == high`, false},
+		{`nan == nan`, false},
+		{`nan != nan`, true},
+		{`nan <= 1`, false},
+		{`nan >= 1`, false},
+		{`1 < nan`, false},
+		{`i != nan`, true},
+	}
+	for _, c := range cases {
+		node, err := geval.NewRuleNode("return "+c.expr, nil)
+		if nil != err {
+			t.Errorf("%s: %v", c.expr, err)
+			continue
+		}
+		result, err := node.EvalResult(dataCtx)
+		if nil != err {
+			t.Errorf("%s: %v", c.expr, err)
+			continue
+		}
+		if result[0] != c.expect {
+			t.Errorf("%s should be %v", c.expr, c.expect)
+		}
+	}
+
+	for _, expr := range []string{`s < 1`, `low < s`, `v < 1`} {
+		node, _ := geval.NewRuleNode("return "+expr, nil)
+		if _, err := node.EvalResult(dataCtx); nil == err {
+			t.Errorf("%s should fail", expr)
+		}
+	}
+}
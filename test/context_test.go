@@ -0,0 +1,395 @@
+package test
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/MagicYH/geval"
+)
+
+func TestRebindAndReset(t *testing.T) {
+	a := 1
+	b := 2
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("a", &a)
+	if err := dataCtx.Bind("a", &b); nil == err {
+		t.Error("Bind twice should fail")
+		return
+	}
+	if err := dataCtx.Rebind("a", &b); nil != err {
+		t.Error("Rebind error: ", err)
+		return
+	}
+	v, _ := dataCtx.Get("a")
+	if v.(*int) != &b {
+		t.Error("Rebind result error")
+		return
+	}
+
+	if err := dataCtx.Unbind("a"); nil != err {
+		t.Error("Unbind error: ", err)
+		return
+	}
+	if _, err := dataCtx.Get("a"); nil == err {
+		t.Error("Variable should not exists after unbind")
+		return
+	}
+
+	dataCtx.Bind("a", &a)
+	dataCtx.Reset()
+	if _, err := dataCtx.Get("a"); nil == err {
+		t.Error("Variable should not exists after reset")
+		return
+	}
+
+	funCtx := geval.NewFunCtx()
+	funCtx.Bind("Max", math.Max)
+	funCtx.Rebind("Max", math.Min)
+	funCtx.Reset()
+	if err := funCtx.Unbind("Max"); nil == err {
+		t.Error("Func should not exists after reset")
+		return
+	}
+
+	node, err := geval.NewRuleNode(`
+	a = len("abc")
+	`, funCtx)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+	dataCtx.Bind("a", &a)
+	if err = node.Eval(dataCtx); nil != err || a != 3 {
+		t.Error("Build in func should be kept after reset: ", err)
+	}
+}
+
+func TestChildContext(t *testing.T) {
+	config := map[string]int{"limit": 100}
+	shared := 0
+	parentData := geval.NewDataCtx()
+	parentData.Bind("config", &config)
+	parentData.Bind("shared", &shared)
+
+	parentFun := geval.NewFunCtx()
+	parentFun.Bind("Max", math.Max)
+
+	limit := 0
+	out := make(map[string]interface{})
+	childData := geval.NewChildDataCtx(parentData)
+	childData.Bind("limit", &limit)
+	childData.Bind("out", &out)
+
+	childFun := geval.NewChildFunCtx(parentFun)
+	childFun.Bind("Min", math.Min)
+
+	rule := `
+	limit = config["limit"]
+	tmp := Max(1, 2) + Min(1, 2)
+	out["tmp"] = tmp
+	shared = 5
+	`
+	node, err := geval.NewRuleNode(rule, childFun)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+	if err = node.Eval(childData); nil != err {
+		t.Error("Eval error: ", err)
+		return
+	}
+
+	t.Log(limit, out, shared)
+	if limit != 100 || out["tmp"] != 3.0 {
+		t.Error("Result error")
+		return
+	}
+	if childShared, _ := childData.Get("shared"); shared != 0 || 5 != *childShared.(*int) {
+		t.Error("Write to parent variable should land in child")
+		return
+	}
+	if _, err := parentData.Get("tmp"); nil == err {
+		t.Error("Temporary variable should be written to child")
+		return
+	}
+	if _, err := childData.Get("tmp"); nil != err {
+		t.Error("Temporary variable not found in child: ", err)
+	}
+}
+
+func TestChildCopyOnWrite(t *testing.T) {
+	limit := 10
+	cfg := map[string]interface{}{"limit": 10, "sub": map[string]interface{}{"name": "a"}}
+	parentData := geval.NewDataCtx()
+	parentData.Bind("limit", &limit)
+	parentData.Bind("cfg", &cfg)
+
+	childData := geval.NewChildDataCtx(parentData)
+	node, err := geval.NewRuleNode(`
+	limit = 99
+	cfg["limit"] = 99
+	cfg["sub"]["name"] = "b"
+	return limit, cfg["limit"], cfg["sub"]["name"]
+	`, nil)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+	result, err := node.EvalResult(childData)
+	if nil != err {
+		t.Error("Eval error: ", err)
+		return
+	}
+	if result[0] != 99 || result[1] != 99 || result[2] != "b" {
+		t.Errorf("Child should see its writes: %v", result)
+	}
+	if limit != 10 || cfg["limit"] != 10 || cfg["sub"].(map[string]interface{})["name"] != "a" {
+		t.Errorf("Parent should not be changed, limit: %v, cfg: %v", limit, cfg)
+	}
+
+	// rollback remove copies made by the transaction
+	childData = geval.NewChildDataCtx(parentData)
+	node, _ = geval.NewRuleNode(`
+	cfg["limit"] = 99
+	limit = undefined
+	`, nil)
+	if _, err = node.EvalTx(childData); nil == err {
+		t.Error("Eval should fail")
+		return
+	}
+	if value, _ := childData.Get("cfg"); value != &cfg {
+		t.Error("Copy of parent variable should be removed by rollback")
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	headers := map[string]string{"token": "abc"}
+	config := map[string]interface{}{"sub": map[string]interface{}{"limit": 10}}
+	person := Person{Name: "Lilei"}
+	limit := 0
+
+	dataCtx := geval.NewDataCtx()
+	dataCtx.BindValue("headers", headers)
+	dataCtx.BindReadOnly("config", &config)
+	dataCtx.BindReadOnly("person", &person)
+	dataCtx.Bind("limit", &limit)
+
+	node, err := geval.NewRuleNode(`
+	limit = config["sub"]["limit"]
+	`, nil)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+	if err = node.Eval(dataCtx); nil != err || limit != 10 {
+		t.Error("Read only variable should be readable: ", err)
+		return
+	}
+
+	rules := []string{
+		`headers = 1`,
+		`headers["token"] = "x"`,
+		`config["sub"]["limit"] = 1`,
+		`person.Pro.Name = "x"`,
+		`person.Age++`,
+		"m := headers\nm[\"token\"] = \"x\"",
+		"sub := config[\"sub\"]\nm := sub\nm[\"limit\"] = 1",
+		"for _, sub := range config {\nsub[\"limit\"] = 1\n}",
+	}
+	for _, rule := range rules {
+		node, err := geval.NewRuleNode(rule, nil)
+		if nil != err {
+			t.Error("New rule error: ", err)
+			return
+		}
+		err = node.Eval(dataCtx)
+		if nil == err {
+			t.Errorf("Write read only variable should fail, rule: %s", rule)
+			return
+		}
+		t.Log(err)
+	}
+
+	if headers["token"] != "abc" || config["sub"].(map[string]interface{})["limit"] != 10 || person.Pro.Name != "" {
+		t.Error("Read only variable is changed")
+	}
+
+	// alias reassigned to other data can be written
+	node, _ = geval.NewRuleNode(`
+	m := headers
+	m = make(map[string]string)
+	m["token"] = "x"
+	`, geval.NewFunCtx())
+	if err = node.Eval(dataCtx); nil != err || person.Name != "Lilei" {
+		t.Error("Write alias reassigned to other data should be allowed: ", err)
+	}
+}
+
+func TestBindValueCopy(t *testing.T) {
+	headers := map[string]string{"token": "abc"}
+	dataCtx := geval.NewDataCtx()
+	dataCtx.BindValue("headers", headers)
+	headers["token"] = "changed"
+
+	node, _ := geval.NewRuleNode(`return headers["token"]`, nil)
+	result, err := node.EvalResult(dataCtx)
+	if nil != err || result[0] != "abc" {
+		t.Errorf("Bound value should be a copy, result: %v, err: %v", result, err)
+	}
+}
+
+func TestLazyAndResolver(t *testing.T) {
+	called := 0
+	out := make(map[string]interface{})
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("out", &out)
+	dataCtx.BindLazy("score", func() (interface{}, error) {
+		called++
+		return 80, nil
+	})
+	dataCtx.BindLazy("unused", func() (interface{}, error) {
+		t.Error("Unused lazy variable should not be computed")
+		return nil, nil
+	})
+	dataCtx.SetResolver(func(name string) (interface{}, bool, error) {
+		if "user_level" == name {
+			return map[string]int{"vip": 3}, true, nil
+		}
+		return nil, false, nil
+	})
+
+	node, err := geval.NewRuleNode(`
+	out["a"] = score + 1
+	out["b"] = score + 2
+	out["level"] = user_level["vip"]
+	`, nil)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+	for i := 0; i < 2; i++ {
+		if err = node.Eval(dataCtx); nil != err {
+			t.Error("Eval error: ", err)
+			return
+		}
+	}
+	t.Log(out)
+	if called != 2 {
+		t.Errorf("Lazy variable should be computed once per eval, called: %d", called)
+		return
+	}
+	if out["a"] != 81.0 || out["b"] != 82.0 || out["level"] != 3 {
+		t.Error("Result error")
+		return
+	}
+
+	for _, rule := range []string{`score = 1`, `user_level["vip"] = 1`, `out["x"] = unknown`} {
+		node, err := geval.NewRuleNode(rule, nil)
+		if nil != err {
+			t.Error("New rule error: ", err)
+			return
+		}
+		if err = node.Eval(dataCtx); nil == err {
+			t.Errorf("Rule should fail: %s", rule)
+			return
+		}
+		t.Log(err)
+	}
+}
+
+func TestResolverError(t *testing.T) {
+	parentData := geval.NewDataCtx()
+	parentData.SetResolver(func(name string) (interface{}, bool, error) {
+		return 1, true, nil
+	})
+	childData := geval.NewChildDataCtx(parentData)
+	childData.SetResolver(func(name string) (interface{}, bool, error) {
+		return nil, false, errors.New("boom")
+	})
+
+	node, _ := geval.NewRuleNode(`return score`, nil)
+	result, err := node.EvalResult(childData)
+	if nil == err || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("Error of child resolver should be returned, result: %v, err: %v", result, err)
+	}
+}
+
+func TestBindJSON(t *testing.T) {
+	payload := `{"user": {"name": "tom", "age": 30, "tags": ["vip"]}, "count": 2}`
+	rule := `
+	name = payload.user.name
+	vip = payload.user.tags[0] == "vip" && payload.user.age == 30 && payload["count"] == 2.0
+	missing = payload.user.email == nil && payload.nothing.deep == nil
+	payload.user.name = "jerry"
+	payload.user.email = "jerry@x.com"
+	`
+	var name string
+	vip, missing := false, false
+	dataCtx := geval.NewDataCtx()
+	if err := dataCtx.BindJSON("payload", []byte(payload)); nil != err {
+		t.Error("Bind json error: ", err)
+		return
+	}
+	dataCtx.Bind("name", &name)
+	dataCtx.Bind("vip", &vip)
+	dataCtx.Bind("missing", &missing)
+
+	node, err := geval.NewRuleNode(rule, nil)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+	if err = node.Eval(dataCtx); nil != err {
+		t.Error("Eval error: ", err)
+		return
+	}
+	if name != "tom" || !vip || !missing {
+		t.Errorf("Result error, name: %s, vip: %v, missing: %v", name, vip, missing)
+		return
+	}
+	data, _ := dataCtx.Get("payload")
+	user := (*data.(*interface{})).(map[string]interface{})["user"].(map[string]interface{})
+	if user["name"] != "jerry" || user["email"] != "jerry@x.com" {
+		t.Errorf("Set by selector error: %v", user)
+	}
+
+	if err = dataCtx.BindJSON("bad", []byte(`{`)); nil == err {
+		t.Error("Bad json should fail")
+	}
+}
+
+func TestMapKey(t *testing.T) {
+	m := map[int]string{1: "a"}
+	var r string
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("m", &m)
+	dataCtx.Bind("r", &r)
+	node, _ := geval.NewRuleNode(`r = m[1] + m[1.0]`, nil)
+	if err := node.Eval(dataCtx); nil != err || r != "aa" {
+		t.Errorf("Int key error, r: %s, err: %v", r, err)
+	}
+	node, _ = geval.NewRuleNode(`r = m["1"]`, nil)
+	if err := node.Eval(dataCtx); nil == err {
+		t.Error("Key of wrong type should fail")
+	}
+}
+
+func TestConditionNotBool(t *testing.T) {
+	dataCtx := geval.NewDataCtx()
+	dataCtx.BindJSON("payload", []byte(`{"user": {"name": "a"}}`))
+	for _, rule := range []string{"if payload.user.vip {\n}", "if payload.user.name {\n}", "for payload.user.vip {\n}"} {
+		node, err := geval.NewRuleNode(rule, nil)
+		if nil != err {
+			t.Error("New rule error: ", err)
+			return
+		}
+		err = node.Eval(dataCtx)
+		if nil == err || !strings.HasPrefix(err.Error(), "1:") || !strings.Contains(err.Error(), "condition should be bool") {
+			t.Errorf("Condition not bool should fail with position, rule: %s, err: %v", rule, err)
+			return
+		}
+		t.Log(err)
+	}
+}
@@ -0,0 +1,91 @@
+package test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/MagicYH/geval"
+)
+
+func TestCoverage(t *testing.T) {
+	total := 0
+	discount := 0.0
+	rule := `if total > 100 {
+	discount = 0.1
+} else {
+	discount = 0
+}
+if total < 0 {
+	discount = 1
+}`
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("total", &total)
+	dataCtx.Bind("discount", &discount)
+
+	node, err := geval.NewRuleNode(rule, nil)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+	node.SetName("discount.rule")
+
+	cov := geval.NewCoverage()
+	cov.Attach(node)
+	for _, v := range []int{50, 150, 200} {
+		total = v
+		if err = node.Eval(dataCtx); nil != err {
+			t.Error("Eval error: ", err)
+			return
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err = cov.WriteProfile(buf); nil != err {
+		t.Error("Write profile error: ", err)
+		return
+	}
+	profile := buf.String()
+	t.Log("\n" + profile)
+	expect := `mode: count
+discount.rule:1.1,1.16 1 3
+discount.rule:2.2,2.16 1 2
+discount.rule:4.2,4.14 1 1
+discount.rule:6.1,6.14 1 3
+discount.rule:7.2,7.14 1 0
+`
+	if profile != expect {
+		t.Error("Profile error")
+		return
+	}
+
+	branches := cov.Branches()
+	t.Log(branches)
+	if len(branches) != 2 || branches[0].Then != 2 || branches[0].Else != 1 || branches[1].Then != 0 || branches[1].Else != 3 {
+		t.Error("Branch coverage error")
+		return
+	}
+	if !strings.HasPrefix(branches[0].File, "discount.rule") {
+		t.Error("Branch file error")
+	}
+}
+
+func TestCoverageUnnamed(t *testing.T) {
+	node, err := geval.NewRuleNode(`a := 1`, nil)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+	cov := geval.NewCoverage()
+	cov.Attach(node)
+	if err = node.Eval(geval.NewDataCtx()); nil != err {
+		t.Error("Eval error: ", err)
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	cov.WriteProfile(buf)
+	if "" != node.Name() || !strings.Contains(buf.String(), "rule1.go:1.1,1.7 1 1") {
+		t.Errorf("Unnamed rule should be reported as rule1.go without renaming node, name: %q, profile:\n%s", node.Name(), buf.String())
+	}
+}
@@ -0,0 +1,120 @@
+package test
+
+import (
+	"go/scanner"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/MagicYH/geval"
+)
+
+const discountTable = `when:customer.Level, when:bill.Total, then:bill.Discount, then:bill.Log, priority
+gold,    [100..1000), 10, """gold""",  1
+gold,    >= 1000,     20, """gold+""", 2
+-,       >= 500,      5,  """big""",   2
+-,       < 100,       0,  ,          0
+`
+
+func TestDecisionTable(t *testing.T) {
+	cases := []struct {
+		policy   geval.HitPolicy
+		customer Customer
+		bill     Bill
+		lines    []int
+		discount float64
+		log      string
+	}{
+		{geval.HitFirst, Customer{Level: "gold"}, Bill{Total: 600}, []int{2}, 10, "gold"},
+		{geval.HitCollect, Customer{Level: "gold"}, Bill{Total: 600}, []int{2, 4}, 5, "big"},
+		{geval.HitPriority, Customer{Level: "gold"}, Bill{Total: 600}, []int{4}, 5, "big"},
+		{geval.HitPriority, Customer{Level: "gold"}, Bill{Total: 2000}, []int{3}, 20, "gold+"},
+		{geval.HitFirst, Customer{Level: "silver"}, Bill{Total: 50, Log: "none"}, []int{5}, 0, "none"},
+		{geval.HitFirst, Customer{Level: "silver"}, Bill{Total: 200}, []int{}, 0, ""},
+	}
+	for i, c := range cases {
+		table, err := geval.NewDecisionTable("discount.csv", strings.NewReader(discountTable), c.policy, nil)
+		if nil != err {
+			t.Error("Load table error: ", err)
+			return
+		}
+		dataCtx := geval.NewDataCtx()
+		dataCtx.Bind("customer", &c.customer)
+		dataCtx.Bind("bill", &c.bill)
+		lines, err := table.Eval(dataCtx)
+		if nil != err {
+			t.Errorf("Case %d eval error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(lines, c.lines) || c.bill.Discount != c.discount || c.bill.Log != c.log {
+			t.Errorf("Case %d result error, lines: %v, bill: %+v", i, lines, c.bill)
+		}
+	}
+
+	table, _ := geval.NewDecisionTable("discount.csv", strings.NewReader(discountTable), geval.HitUnique, nil)
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("customer", &Customer{Level: "gold"})
+	dataCtx.Bind("bill", &Bill{Total: 600})
+	if _, err := table.Eval(dataCtx); nil == err {
+		t.Error("Rows match at the same time should fail with hit policy unique")
+	}
+}
+
+func TestDecisionTableValidate(t *testing.T) {
+	table, err := geval.NewDecisionTable("discount.csv", strings.NewReader(discountTable), geval.HitUnique, nil)
+	if nil != err {
+		t.Error("Load table error: ", err)
+		return
+	}
+	var overlaps [][]int
+	gaps := 0
+	for _, issue := range table.Validate() {
+		t.Log(issue)
+		switch issue.Kind {
+		case "overlap":
+			overlaps = append(overlaps, issue.Lines)
+		case "gap":
+			gaps++
+			if total := issue.Example["bill.Total"].(float64); total < 100 || total >= 500 {
+				t.Errorf("Gap example error: %v", issue.Example)
+			}
+		}
+	}
+	if !reflect.DeepEqual(overlaps, [][]int{{2, 4}, {3, 4}}) {
+		t.Errorf("Overlap error: %v", overlaps)
+	}
+	if 0 == gaps {
+		t.Error("Missing rows for total in [100, 500) of other level should be reported")
+	}
+
+	table, _ = geval.NewDecisionTable("discount.csv", strings.NewReader(discountTable), geval.HitPriority, nil)
+	for _, issue := range table.Validate() {
+		if "overlap" == issue.Kind && !reflect.DeepEqual(issue.Lines, []int{3, 4}) {
+			t.Errorf("Rows with different priority should not be reported: %v", issue.Lines)
+		}
+	}
+}
+
+func TestDecisionTableError(t *testing.T) {
+	content := `when:a, then:b
+[1..2, 1
+>, 2
+1, 1 +
+`
+	_, err := geval.NewDecisionTable("bad.csv", strings.NewReader(content), geval.HitFirst, nil)
+	if nil == err {
+		t.Error("Bad table should fail")
+		return
+	}
+	list, ok := err.(scanner.ErrorList)
+	if !ok || 3 != len(list) {
+		t.Errorf("All errors should be reported: %v", err)
+		return
+	}
+	for i, expect := range []string{"bad.csv:2:1", "bad.csv:3:1", "bad.csv:4"} {
+		t.Log(list[i])
+		if !strings.HasPrefix(list[i].Error(), expect) {
+			t.Errorf("Error should start with %s", expect)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/MagicYH/geval"
+)
+
+func TestEvalExplain(t *testing.T) {
+	order := Order{Total: 120}
+	discount := 0.0
+	rule := `
+	if order.Total > 100 {
+		discount = 0.1
+	} else if order.Total > 50 {
+		discount = 0.05
+	}
+	`
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("order", &order)
+	dataCtx.Bind("discount", &discount)
+
+	node, err := geval.NewRuleNode(rule, nil)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+
+	explain, err := node.EvalExplain(dataCtx)
+	if nil != err {
+		t.Error("Eval error: ", err)
+		return
+	}
+	text := explain.String()
+	t.Log("\n" + text)
+
+	expect := []string{
+		"2:2: if order.Total > 100",
+		"order.Total (120) > 100 → true",
+		"then",
+		"3:3: discount = 0.1",
+		"else (skipped)",
+	}
+	for _, line := range expect {
+		if !strings.Contains(text, line) {
+			t.Errorf("Explain text should contain: %s", line)
+			return
+		}
+	}
+
+	data, err := explain.JSON()
+	if nil != err {
+		t.Error("Explain json error: ", err)
+		return
+	}
+	decoded := geval.Explain{}
+	if err = json.Unmarshal(data, &decoded); nil != err {
+		t.Error("Decode explain json error: ", err)
+		return
+	}
+	ifNode := decoded.Children[0]
+	if "if" != ifNode.Kind || "binary" != ifNode.Children[0].Kind || !ifNode.Children[2].Skipped {
+		t.Error("Explain json error: ", string(data))
+	}
+}
+
+func TestExplainShortCircuit(t *testing.T) {
+	order := Order{Total: 120}
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("order", &order)
+
+	node, err := geval.NewRuleNode(`return order.Total > 100 || order.Total < 0`, nil)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+	explain, err := node.EvalExplain(dataCtx)
+	if nil != err {
+		t.Error("Eval error: ", err)
+		return
+	}
+	text := explain.String()
+	t.Log("\n" + text)
+	if !strings.Contains(text, "|| order.Total < 0 (not evaluated) → true") || strings.Contains(text, "<nil>") {
+		t.Error("Operand skipped by short circuit should be marked not evaluated")
+	}
+}
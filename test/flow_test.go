@@ -0,0 +1,136 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/MagicYH/geval"
+)
+
+const riskFlow = `{
+	"name": "risk",
+	"start": "score",
+	"nodes": [
+		{"name": "score", "ref": "score"},
+		{"name": "review", "rule": "log = log + \"review;\"", "fork": true},
+		{"name": "pass", "rule": "log = log + \"pass;\""},
+		{"name": "manual", "rule": "log = log + \"manual;\""},
+		{"name": "notify", "rule": "log = log + \"notify;\""},
+		{"name": "merge", "rule": "log = log + \"merge;\"", "join": true}
+	],
+	"edges": [
+		{"from": "score", "to": "review", "when": "risk > 50"},
+		{"from": "score", "to": "pass"},
+		{"from": "review", "to": "manual"},
+		{"from": "review", "to": "notify", "when": "risk > 80"},
+		{"from": "manual", "to": "merge"},
+		{"from": "notify", "to": "merge"},
+		{"from": "pass", "to": "merge"}
+	]
+}`
+
+func TestFlow(t *testing.T) {
+	score, err := geval.NewRuleNode(`risk = amount / 10`, nil)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+	flow, err := geval.LoadFlow([]byte(riskFlow), map[string]geval.FlowStep{"score": score}, nil)
+	if nil != err {
+		t.Error("Load flow error: ", err)
+		return
+	}
+
+	cases := []struct {
+		amount float64
+		log    string
+		path   []string
+	}{
+		{100, "pass;merge;", []string{"score", "pass", "merge"}},
+		{600, "review;manual;merge;", []string{"score", "review", "manual", "merge"}},
+		{900, "review;manual;notify;merge;", []string{"score", "review", "manual", "notify", "merge"}},
+	}
+	for i, c := range cases {
+		risk := 0.0
+		log := ""
+		dataCtx := geval.NewDataCtx()
+		dataCtx.Bind("amount", &c.amount)
+		dataCtx.Bind("risk", &risk)
+		dataCtx.Bind("log", &log)
+		visits, err := flow.Run(dataCtx)
+		if nil != err {
+			t.Errorf("Case %d run error: %v", i, err)
+			continue
+		}
+		var path []string
+		for _, visit := range visits {
+			path = append(path, visit.Node)
+		}
+		if log != c.log || !reflect.DeepEqual(path, c.path) {
+			t.Errorf("Case %d result error, log: %s, path: %v", i, log, path)
+		}
+		if last := visits[len(visits)-1]; 2 == i && !reflect.DeepEqual(last.From, []string{"manual", "notify"}) {
+			t.Errorf("Join should record all branches: %v", last.From)
+		}
+	}
+}
+
+func TestFlowLoop(t *testing.T) {
+	count := 0
+	flow := geval.NewFlow("loop", nil)
+	flow.AddNode(geval.FlowNode{Name: "inc", Rule: `count++`})
+	flow.AddNode(geval.FlowNode{Name: "done"})
+	flow.AddEdge(geval.FlowEdge{From: "inc", To: "inc", When: `count < 3`})
+	flow.AddEdge(geval.FlowEdge{From: "inc", To: "done"})
+
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("count", &count)
+	visits, err := flow.Run(dataCtx)
+	if nil != err || count != 3 || len(visits) != 4 {
+		t.Errorf("Loop error, count: %d, visits: %v, err: %v", count, visits, err)
+		return
+	}
+
+	flow.SetMaxSteps(2)
+	count = 0
+	if _, err = flow.Run(dataCtx); nil == err {
+		t.Error("Flow should stop when it runs too many nodes")
+	}
+
+	if err = flow.AddEdge(geval.FlowEdge{From: "inc", To: "missing"}); nil == err {
+		t.Error("Edge to missing node should fail")
+	}
+	if err = flow.AddEdge(geval.FlowEdge{From: "inc", To: "done", When: `count <`}); nil == err {
+		t.Error("Bad guard should fail")
+	}
+}
+
+func TestFlowBadGuard(t *testing.T) {
+	funCtx := geval.NewFunCtx()
+	funCtx.Bind("noop", func() {})
+	flow := geval.NewFlow("guard", funCtx)
+	flow.AddNode(geval.FlowNode{Name: "start"})
+	flow.AddNode(geval.FlowNode{Name: "end"})
+	if err := flow.AddEdge(geval.FlowEdge{From: "start", To: "end", When: "true }\nfunc g() {"}); nil == err {
+		t.Error("Guard should be single expression")
+		return
+	}
+
+	flow.AddEdge(geval.FlowEdge{From: "start", To: "end", When: `noop()`})
+	_, err := flow.Run(geval.NewDataCtx())
+	if nil == err {
+		t.Error("Guard without value should fail")
+		return
+	}
+	t.Log(err)
+
+	count := 0
+	loop := geval.NewFlow("loop", nil)
+	loop.AddNode(geval.FlowNode{Name: "inc", Rule: `count++`})
+	loop.AddEdge(geval.FlowEdge{From: "inc", To: "inc"})
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("count", &count)
+	if _, err := loop.Run(dataCtx); nil == err || count != geval.DefaultMaxFlowSteps {
+		t.Errorf("Endless flow should stop after %d steps, count: %d", geval.DefaultMaxFlowSteps, count)
+	}
+}
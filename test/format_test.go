@@ -0,0 +1,66 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/MagicYH/geval"
+)
+
+func TestFormat(t *testing.T) {
+	rule := `a:=1
+   // check a
+if a>0{
+b  =  a+1
+s := ` + "`x\n  y`" + `
+}`
+	expect := `a := 1
+// check a
+if a > 0 {
+	b = a + 1
+	s := ` + "`x\n  y`" + `
+}`
+	out, err := geval.Format(rule)
+	if nil != err {
+		t.Error("Format error: ", err)
+		return
+	}
+	if out != expect {
+		t.Errorf("Format result error, expect:\n%s\nreal:\n%s", expect, out)
+		return
+	}
+
+	again, _ := geval.Format(out)
+	if again != out {
+		t.Error("Format should be stable")
+		return
+	}
+
+	_, err = geval.Format("a := 1\nb := )\nc := 2")
+	if nil == err || !strings.HasPrefix(err.Error(), "2:") {
+		t.Errorf("Syntax error should be positioned in rule, real: %v", err)
+	}
+}
+
+func TestCanonicalHash(t *testing.T) {
+	hash1, err := geval.CanonicalHash("a:=1\nif a>0{b=a}")
+	if nil != err {
+		t.Error("Hash error: ", err)
+		return
+	}
+	hash2, _ := geval.CanonicalHash("// comment\na := 1\n\nif a > 0 {\n\tb = a\n}")
+	hash3, _ := geval.CanonicalHash("a := 1\nif a > 0 {\n\tb = a + 0\n}")
+	if hash1 != hash2 {
+		t.Error("Hash of same rule should be equal")
+		return
+	}
+	if hash1 == hash3 {
+		t.Error("Hash of different rule should not be equal")
+		return
+	}
+
+	node, _ := geval.NewRuleNode("a := 1\nif a > 0 {\n\tb = a\n}", nil)
+	if hash, _ := node.CanonicalHash(); hash != hash1 {
+		t.Error("Hash of rule node error")
+	}
+}
@@ -0,0 +1,102 @@
+package test
+
+import (
+	"go/ast"
+	"go/token"
+	"math"
+	"testing"
+
+	"github.com/MagicYH/geval"
+)
+
+type callRecorder struct {
+	geval.NopHooks
+	lines []int
+	calls []string
+}
+
+func (r *callRecorder) BeforeStmt(pos token.Position, node ast.Stmt) error {
+	r.lines = append(r.lines, pos.Line)
+	return nil
+}
+
+func (r *callRecorder) OnCall(name string, args []interface{}, results []interface{}) {
+	r.calls = append(r.calls, name)
+}
+
+func TestEvalHooks(t *testing.T) {
+	a := 0.0
+	rule := `a = Max(1, 2)
+if a > 1 {
+	a = Max(a, 3)
+}`
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("a", &a)
+	funCtx := geval.NewFunCtx()
+	funCtx.Bind("Max", math.Max)
+
+	node, err := geval.NewRuleNode(rule, funCtx)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+	recorder := &callRecorder{}
+	node.AddHooks(recorder)
+	if err = node.Eval(dataCtx); nil != err {
+		t.Error("Eval error: ", err)
+		return
+	}
+	t.Log(recorder.lines, recorder.calls)
+	if len(recorder.lines) != 3 || recorder.lines[0] != 1 || recorder.lines[1] != 2 || recorder.lines[2] != 3 {
+		t.Error("BeforeStmt lines error")
+		return
+	}
+	if len(recorder.calls) != 2 || recorder.calls[0] != "Max" {
+		t.Error("OnCall error")
+	}
+}
+
+func TestDebugger(t *testing.T) {
+	a := 0
+	rule := `a = 1
+a = 2
+a = 3
+a = 4`
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("a", &a)
+
+	node, err := geval.NewRuleNode(rule, nil)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+
+	var sources []string
+	var values []interface{}
+	debugger := geval.NewDebugger(node, dataCtx, func(event *geval.BreakEvent) geval.DebugAction {
+		sources = append(sources, event.Source)
+		values = append(values, event.Vars["a"])
+		if 2 == event.Pos.Line {
+			return geval.DebugStep
+		}
+		return geval.DebugContinue
+	})
+	debugger.SetBreakpoint(2)
+	if err = debugger.Eval(); nil != err {
+		t.Error("Eval error: ", err)
+		return
+	}
+	t.Log(sources, values)
+	if len(sources) != 2 || sources[0] != "a = 2" || sources[1] != "a = 3" || values[0] != 1 || values[1] != 2 {
+		t.Error("Debugger break error")
+		return
+	}
+
+	debugger = geval.NewDebugger(node, dataCtx, func(event *geval.BreakEvent) geval.DebugAction {
+		return geval.DebugAbort
+	})
+	debugger.SetBreakpoint(3)
+	if err = node.Eval(dataCtx); err != geval.ErrDebugAbort || a != 2 {
+		t.Error("Debugger abort error: ", err)
+	}
+}
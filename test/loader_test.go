@@ -0,0 +1,111 @@
+package test
+
+import (
+	"bytes"
+	"go/scanner"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/MagicYH/geval"
+)
+
+func TestLoadRules(t *testing.T) {
+	fsys := fstest.MapFS{
+		"order/discount.rule": {Data: []byte(`// @name: vip_discount
+// @priority: 10
+// @tags: order, vip
+// @owner: trade
+discount = 5
+`)},
+		"order/off.rule": {Data: []byte("// @enabled: false\ndiscount = 0\n")},
+		"readme.txt":     {Data: []byte("not rule")},
+	}
+
+	entries, err := geval.LoadRules(fsys, nil)
+	if nil != err {
+		t.Error("Load rules error: ", err)
+		return
+	}
+	if len(entries) != 2 {
+		t.Errorf("Entry number error: %d", len(entries))
+		return
+	}
+	vip, off := entries[0], entries[1]
+	if vip.Name != "vip_discount" || vip.Priority != 10 || !vip.Enabled || len(vip.Tags) != 2 || vip.Owner != "trade" {
+		t.Errorf("Header meta error: %+v", vip.RuleMeta)
+		return
+	}
+	if off.Name != "off" || off.Enabled || off.File != "order/off.rule" {
+		t.Errorf("Default meta error: %+v", off.RuleMeta)
+		return
+	}
+
+	discount := 0
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("discount", &discount)
+	if err = vip.Node.Eval(dataCtx); nil != err || discount != 5 {
+		t.Error("Eval loaded rule error: ", err)
+	}
+
+	// header name do not replace file in positions
+	cov := geval.NewCoverage()
+	cov.Attach(vip.Node)
+	vip.Node.Eval(dataCtx)
+	buf := &bytes.Buffer{}
+	cov.WriteProfile(buf)
+	if vip.Node.Name() != "vip_discount" || !strings.Contains(buf.String(), "order/discount.rule:5.1,5.13 1 1") {
+		t.Errorf("Positions should point to rule file, name: %s, profile:\n%s", vip.Node.Name(), buf.String())
+	}
+}
+
+func TestLoadRulesManifest(t *testing.T) {
+	fsys := fstest.MapFS{
+		"rules.json": {Data: []byte(`{"rules": [
+			{"file": "b.rule", "priority": 3, "description": "from manifest"},
+			{"file": "a.rule", "enabled": false}
+		]}`)},
+		"a.rule":     {Data: []byte("// @priority: 1\na = 1\n")},
+		"b.rule":     {Data: []byte("b = 1\n")},
+		"extra.rule": {Data: []byte("not loaded")},
+	}
+
+	entries, err := geval.LoadRules(fsys, nil)
+	if nil != err {
+		t.Error("Load rules error: ", err)
+		return
+	}
+	if len(entries) != 2 || entries[0].Name != "b" || entries[1].Name != "a" {
+		t.Error("Manifest rules should be loaded in order")
+		return
+	}
+	if entries[0].Priority != 3 || entries[0].Description != "from manifest" || entries[1].Priority != 1 || entries[1].Enabled {
+		t.Errorf("Manifest meta error: %+v, %+v", entries[0].RuleMeta, entries[1].RuleMeta)
+	}
+}
+
+func TestLoadRulesErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.rule": {Data: []byte("// @priority: high\na = 1\n")},
+		"b.rule": {Data: []byte("// @name: x\n\nb := 1 2\n")},
+		"c.rule": {Data: []byte("// @name: x\nc = 1\n")},
+		"d.rule": {Data: []byte("// @name: x\nd = 1\n")},
+	}
+
+	_, err := geval.LoadRules(fsys, nil)
+	if nil == err {
+		t.Error("Load should fail")
+		return
+	}
+	list, ok := err.(scanner.ErrorList)
+	if !ok || len(list) != 3 {
+		t.Errorf("All errors should be reported, real: %v", err)
+		return
+	}
+	for i, expect := range []string{"a.rule:1", "b.rule:3", "d.rule: rule name 'x' is used by c.rule"} {
+		t.Log(list[i])
+		if !strings.HasPrefix(list[i].Error(), expect) {
+			t.Errorf("Error should start with %s", expect)
+		}
+	}
+}
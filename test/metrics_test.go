@@ -0,0 +1,53 @@
+package test
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/MagicYH/geval"
+)
+
+func TestMemMetrics(t *testing.T) {
+	a := 0.0
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("a", &a)
+	funCtx := geval.NewFunCtx()
+	funCtx.Bind("Pow", math.Pow)
+
+	node, err := geval.NewRuleNode(`
+	a = Pow(2, 3)
+	`, funCtx)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+	node.SetName("pow")
+
+	metrics := geval.NewMemMetrics()
+	node.SetMetrics(metrics, true)
+	for i := 0; i < 10; i++ {
+		if err = node.Eval(dataCtx); nil != err {
+			t.Error("Eval error: ", err)
+			return
+		}
+	}
+
+	stats := metrics.Stats()
+	if len(stats) != 1 || stats[0].Rule != "pow" || stats[0].Count != 10 || stats[0].P99 <= 0 || stats[0].Allocs <= 0 {
+		t.Error("Rule stats error: ", stats)
+		return
+	}
+	if len(stats[0].Calls) != 1 || stats[0].Calls[0].Func != "Pow" || stats[0].Calls[0].Count != 10 {
+		t.Error("Call stats error: ", stats[0].Calls)
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	metrics.Dump(buf)
+	t.Log("\n" + buf.String())
+	if !strings.Contains(buf.String(), "pow") {
+		t.Error("Dump error")
+	}
+}
@@ -0,0 +1,104 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/MagicYH/geval"
+)
+
+// Money : Amount in cents with currency
+type Money struct {
+	Cents    int64
+	Currency string
+}
+
+func (m Money) Add(other interface{}) (interface{}, error) {
+	o, ok := other.(Money)
+	if !ok || o.Currency != m.Currency {
+		return nil, fmt.Errorf("can not add %v to %v", other, m)
+	}
+	return Money{m.Cents + o.Cents, m.Currency}, nil
+}
+
+func (m Money) Sub(other interface{}) (interface{}, error) {
+	o, ok := other.(Money)
+	if !ok || o.Currency != m.Currency {
+		return nil, fmt.Errorf("can not sub %v from %v", other, m)
+	}
+	return Money{m.Cents - o.Cents, m.Currency}, nil
+}
+
+func (m Money) Mul(other interface{}) (interface{}, error) {
+	switch n := other.(type) {
+	case int:
+		return Money{m.Cents * int64(n), m.Currency}, nil
+	case float64:
+		return Money{int64(float64(m.Cents) * n), m.Currency}, nil
+	}
+	return nil, fmt.Errorf("can not mul %v by %T", m, other)
+}
+
+func (m Money) Div(other interface{}) (interface{}, error) {
+	n, ok := other.(int)
+	if !ok || 0 == n {
+		return nil, fmt.Errorf("can not div %v by %v", m, other)
+	}
+	return Money{m.Cents / int64(n), m.Currency}, nil
+}
+
+// Vector : Operator defined on ptr receiver
+type Vector struct {
+	X, Y float64
+}
+
+func (v *Vector) Add(other interface{}) (interface{}, error) {
+	o := other.(Vector)
+	return Vector{v.X + o.X, v.Y + o.Y}, nil
+}
+
+func TestOperatorInterface(t *testing.T) {
+	price := Money{250, "USD"}
+	fee := Money{100, "USD"}
+	yen := Money{100, "JPY"}
+	qty := 3
+	var total, each, net Money
+	v1, v2 := Vector{1, 2}, Vector{3, 4}
+	var sum Vector
+
+	dataCtx := geval.NewDataCtx()
+	for name, data := range map[string]interface{}{
+		"price": &price, "fee": &fee, "yen": &yen, "qty": &qty, "total": &total,
+		"each": &each, "net": &net, "v1": &v1, "v2": &v2, "sum": &sum,
+	} {
+		dataCtx.Bind(name, data)
+	}
+
+	rule := `
+	total = qty * price + fee
+	each = total / qty
+	net = total - fee
+	sum = v1 + v2
+	`
+	node, err := geval.NewRuleNode(rule, nil)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+	if err = node.Eval(dataCtx); nil != err {
+		t.Error("Eval error: ", err)
+		return
+	}
+	if total.Cents != 850 || each.Cents != 283 || net.Cents != 750 || sum != (Vector{4, 6}) {
+		t.Errorf("Result error, total: %v, each: %v, net: %v, sum: %v", total, each, net, sum)
+	}
+
+	for _, rule := range []string{`total = price + yen`, `total = qty - price`, `total = fee / price`, `sum = v1 * v2`} {
+		node, _ := geval.NewRuleNode(rule, nil)
+		err := node.Eval(dataCtx)
+		t.Log(err)
+		if nil == err {
+			t.Errorf("%s should fail", rule)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/MagicYH/geval"
+)
+
+type geoPackage struct {
+	Distance func(x1, y1, x2, y2 float64) float64
+}
+
+func (g geoPackage) Origin() float64 {
+	return 0
+}
+
+func TestBindPackage(t *testing.T) {
+	d := make(map[string]interface{})
+	geo := geoPackage{
+		Distance: func(x1, y1, x2, y2 float64) float64 {
+			return math.Sqrt((x2-x1)*(x2-x1) + (y2-y1)*(y2-y1))
+		},
+	}
+	rule := `
+	d["dist"] = geo.Distance(0, 0, 3, 4)
+	d["origin"] = geo.Origin()
+	d["upper"] = str.ToUpper("hello")
+	`
+
+	funCtx := geval.NewFunCtx()
+	if err := funCtx.BindPackage("geo", geo); nil != err {
+		t.Error("Bind package error: ", err)
+		return
+	}
+	if err := funCtx.BindPackage("str", map[string]interface{}{"ToUpper": strings.ToUpper}); nil != err {
+		t.Error("Bind package error: ", err)
+		return
+	}
+	if err := funCtx.BindPackage("geo", geo); nil == err {
+		t.Error("Bind package twice should fail")
+		return
+	}
+
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("d", &d)
+
+	node, err := geval.NewRuleNode(rule, funCtx)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+
+	err = node.Eval(dataCtx)
+	if nil != err {
+		t.Error("Eval error: ", err)
+		return
+	}
+
+	t.Log(d)
+	if d["dist"] != 5.0 || d["origin"] != 0.0 || d["upper"] != "HELLO" {
+		t.Error("Result error")
+		return
+	}
+}
+
+func TestPackageCollision(t *testing.T) {
+	funCtx := geval.NewFunCtx()
+	funCtx.BindPackage("geo", map[string]interface{}{"Abs": math.Abs})
+
+	_, err := geval.NewRuleNode(`
+	geo := 1
+	`, funCtx)
+	if nil == err {
+		t.Error("Collision between variable and package should fail")
+		return
+	}
+	t.Log(err)
+
+	if err := funCtx.Bind("geo", math.Abs); nil == err {
+		t.Error("Collision between func and package should fail")
+	}
+
+	// data variable named like package can not be reached by rule
+	geo := 1.0
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("geo", &geo)
+	for _, rule := range []string{`geo.Abs(-1)`, `x := geo.Abs`} {
+		node, _ := geval.NewRuleNode(rule, funCtx)
+		if err := node.Eval(dataCtx); nil == err {
+			t.Errorf("%s: collision between data and package should fail", rule)
+		}
+	}
+
+	if err := funCtx.BindPackage("conf", map[string]interface{}{"X": 5}); nil == err {
+		t.Error("Package member which is not func should fail")
+	}
+}
@@ -0,0 +1,192 @@
+package test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/MagicYH/geval"
+)
+
+func TestParallelEngine(t *testing.T) {
+	rules := []struct {
+		name     string
+		priority int
+		rule     string
+	}{
+		{"sum", 0, `out1["sum"] = base + 1`},
+		{"double", 0, `out2["double"] = base * 2`},
+		{"copy", 0, `out1["copy"] = out2["double"]`},
+		{"count", 0, `total = total + 1`},
+		{"first", 1, `out2["double"] = 1`},
+		{"say", 0, `person.Say("hi")`},
+		{"name", 0, `name := person.Name
+		out3["name"] = name`},
+	}
+
+	run := func(parallel bool) (map[string]interface{}, map[string]interface{}, [][]string) {
+		base := 10
+		total := 0
+		out1 := make(map[string]interface{})
+		out2 := make(map[string]interface{})
+		out3 := make(map[string]interface{})
+		person := Person{Name: "Lilei"}
+
+		workers := 4
+		if !parallel {
+			workers = 1
+		}
+		engine := geval.NewParallelEngine(workers)
+		engine.AddData("base", &base)
+		engine.AddData("total", &total)
+		engine.AddData("out1", &out1)
+		engine.AddData("out2", &out2)
+		engine.AddData("out3", &out3)
+		engine.AddData("person", &person)
+		for _, r := range rules {
+			node, err := geval.NewRuleNode(r.rule, nil)
+			if nil != err {
+				t.Fatal("New rule error: ", err)
+			}
+			node.SetName(r.name)
+			engine.AddRule(node, r.priority)
+		}
+		if err := engine.Eval(); nil != err {
+			t.Fatal("Eval error: ", err)
+		}
+		out1["total"] = total
+		return out1, out2, engine.Plan()
+	}
+
+	out1, out2, plan := run(true)
+	seqOut1, seqOut2, _ := run(false)
+	t.Log(plan, out1, out2)
+	if !reflect.DeepEqual(out1, seqOut1) || !reflect.DeepEqual(out2, seqOut2) {
+		t.Error("Parallel result should be the same as sequential")
+		return
+	}
+	expect := [][]string{{"first", "sum", "count", "say"}, {"double", "name"}, {"copy"}}
+	if !reflect.DeepEqual(plan, expect) {
+		t.Errorf("Plan error: %v", plan)
+	}
+}
+
+func TestParallelEngineError(t *testing.T) {
+	out := make(map[string]interface{})
+	engine := geval.NewParallelEngine(2)
+	engine.AddData("out", &out)
+	for _, rule := range []string{`out["a"] = 1`, `out["b"] = missing`, `out["c"] = 1`} {
+		node, _ := geval.NewRuleNode(rule, nil)
+		engine.AddRule(node, 0)
+	}
+	if err := engine.Eval(); nil == err {
+		t.Error("Eval should fail")
+		return
+	}
+	if _, ok := out["c"]; ok || out["a"] != 1 {
+		t.Errorf("Rules after failed one should be skipped: %v", out)
+	}
+}
+
+func TestParallelEngineMapSelector(t *testing.T) {
+	engine := geval.NewParallelEngine(2)
+	engine.DataCtx().BindJSON("payload", []byte(`{"a": 1, "b": 2}`))
+	bill := Bill{}
+	engine.AddData("bill", &bill)
+	rules := map[string]string{
+		"a":        `payload.a = 10`,
+		"b":        `payload.b = 20`,
+		"total":    `bill.Total = 1`,
+		"discount": `bill.Discount = 2`,
+	}
+	for _, name := range []string{"a", "b", "total", "discount"} {
+		node, _ := geval.NewRuleNode(rules[name], nil)
+		node.SetName(name)
+		engine.AddRule(node, 0)
+	}
+	plan := engine.Plan()
+	expect := [][]string{{"a", "total", "discount"}, {"b"}}
+	if !reflect.DeepEqual(plan, expect) {
+		t.Errorf("Keys of map should not be written in parallel, plan: %v", plan)
+	}
+	if err := engine.Eval(); nil != err {
+		t.Error("Eval error: ", err)
+	}
+}
+
+func TestParallelEngineRollback(t *testing.T) {
+	a, b, c := 0, 0, 0
+	written := make(chan bool)
+	engine := geval.NewParallelEngine(2)
+	engine.AddData("a", &a)
+	engine.AddData("b", &b)
+	engine.AddData("c", &c)
+	// fail only after the independent rule ordered after it has finished
+	engine.AddFunc("wait", func() { <-written })
+	engine.AddFunc("done", func() { close(written) })
+
+	rules := []struct {
+		name     string
+		priority int
+		rule     string
+	}{
+		{"fail", 2, "a = 1\nwait()\na = missing"},
+		{"independent", 1, "b = 2\ndone()"},
+		{"dependent", 0, `c = a`},
+	}
+	for _, r := range rules {
+		node, _ := geval.NewRuleNode(r.rule, nil)
+		node.SetName(r.name)
+		engine.AddRule(node, r.priority)
+	}
+	err := engine.Eval()
+	if nil == err || !strings.Contains(err.Error(), "Rule fail") {
+		t.Error("Error of failed rule should be returned: ", err)
+		return
+	}
+	if a != 1 || b != 0 || c != 0 {
+		t.Errorf("Writes of rules after failed one should be rolled back, a: %d, b: %d, c: %d", a, b, c)
+	}
+}
+
+func TestParallelEngineAlias(t *testing.T) {
+	dict := map[string]interface{}{"k": 1}
+	out := make(map[string]interface{})
+	engine := geval.NewParallelEngine(2)
+	engine.AddData("dict", &dict)
+	engine.AddData("out", &out)
+	for _, rule := range []string{"m := dict\nm[\"k\"] = 2", `out["v"] = dict["k"]`} {
+		node, _ := geval.NewRuleNode(rule, nil)
+		engine.AddRule(node, 0)
+	}
+	if plan := engine.Plan(); len(plan) != 2 {
+		t.Errorf("Write through local should conflict with read of the data: %v", plan)
+		return
+	}
+	if err := engine.Eval(); nil != err || out["v"] != 2 {
+		t.Errorf("Result error, out: %v, err: %v", out, err)
+	}
+}
+
+func TestParallelEngineCallArg(t *testing.T) {
+	dict := map[string]int{"k": 1}
+	out := make(map[string]interface{})
+	engine := geval.NewParallelEngine(2)
+	engine.AddData("dict", &dict)
+	engine.AddData("out", &out)
+	engine.AddFunc("fill", func(m map[string]int) int {
+		m["k"] = 2
+		return len(m)
+	})
+	for _, rule := range []string{`x := fill(dict)`, `out["v"] = dict["k"]`} {
+		node, _ := geval.NewRuleNode(rule, nil)
+		engine.AddRule(node, 0)
+	}
+	if plan := engine.Plan(); len(plan) != 2 {
+		t.Errorf("Data passed to function should be taken as written: %v", plan)
+		return
+	}
+	if err := engine.Eval(); nil != err || out["v"] != 2 {
+		t.Errorf("Result error, out: %v, err: %v", out, err)
+	}
+}
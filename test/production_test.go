@@ -0,0 +1,255 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/MagicYH/geval"
+)
+
+type Customer struct {
+	Level string
+	Spent float64
+}
+
+type Bill struct {
+	Total    float64
+	Discount float64
+	Log      string
+}
+
+func TestProductionEngine(t *testing.T) {
+	customer := Customer{Spent: 2000}
+	bill := Bill{Total: 600}
+	checked := make(map[string]int)
+
+	engine := geval.NewProductionEngine()
+	engine.AddData("customer", &customer)
+	engine.AddData("bill", &bill)
+	engine.AddFunc("Check", func(name string) bool {
+		checked[name]++
+		return true
+	})
+
+	productions := []geval.Production{
+		{Name: "gold", When: `Check("gold") && customer.Spent > 1000 && customer.Level != "gold"`, Then: `customer.Level = "gold"`},
+		{Name: "discount", When: `customer.Level == "gold"`, Then: `bill.Discount = 10`},
+		{Name: "audit", When: `bill.Discount > 0`, Then: `bill.Log = bill.Log + "discount;"`},
+		{Name: "big", Salience: -1, When: `Check("big") && bill.Total > 500`, Then: `bill.Log = bill.Log + "big;"`},
+		{Name: "coupon", When: `coupon.Value > 0`, Then: `bill.Discount = coupon.Value`},
+	}
+	for _, production := range productions {
+		if err := engine.AddProduction(production); nil != err {
+			t.Error("Add rule error: ", err)
+			return
+		}
+	}
+
+	if err := engine.Eval(); nil != err {
+		t.Error("Eval error: ", err)
+		return
+	}
+	t.Log(engine.Fired(), checked)
+	if !reflect.DeepEqual(engine.Fired(), []string{"gold", "discount", "audit", "big"}) {
+		t.Errorf("Fire order error: %v", engine.Fired())
+		return
+	}
+	if customer.Level != "gold" || bill.Discount != 10 || bill.Log != "discount;big;" {
+		t.Errorf("Result error: %+v, %+v", customer, bill)
+		return
+	}
+	if checked["gold"] != 2 || checked["big"] != 1 {
+		t.Errorf("Condition should only be checked when facts it reads change: %v", checked)
+	}
+}
+
+func TestProductionEngineLoop(t *testing.T) {
+	count := 0
+	engine := geval.NewProductionEngine()
+	engine.AddData("count", &count)
+	engine.SetMaxFires(100)
+	engine.AddProduction(geval.Production{Name: "inc", When: `count < 5`, Then: `count++`})
+	if err := engine.Eval(); nil != err || count != 5 {
+		t.Errorf("Rule should fire until condition false, count: %d, err: %v", count, err)
+		return
+	}
+
+	engine.AddProduction(geval.Production{Name: "endless", When: `count > 0`, Then: `count++`})
+	if err := engine.Eval(); nil == err {
+		t.Error("Endless loop should be stopped")
+	}
+}
+
+func TestConflictStrategy(t *testing.T) {
+	a, b := 1, 2
+	newEngine := func() *geval.ProductionEngine {
+		engine := geval.NewProductionEngine()
+		engine.AddData("a", &a)
+		engine.AddData("b", &b)
+		engine.AddProduction(geval.Production{Name: "first", When: `a > 0`})
+		engine.AddProduction(geval.Production{Name: "specific", When: `a > 0 && b > 0`})
+		engine.AddProduction(geval.Production{Name: "salience", Salience: 10, When: `b > 0`})
+		return engine
+	}
+
+	cases := []struct {
+		strategy geval.ConflictStrategy
+		expect   []string
+	}{
+		{geval.Strategies(geval.BySalience), []string{"salience", "first", "specific"}},
+		{geval.Strategies(geval.BySpecificity, geval.BySalience), []string{"specific", "salience", "first"}},
+		{geval.Strategies(geval.ByRecency), []string{"salience", "specific", "first"}},
+		{geval.ByOrder, []string{"first", "specific", "salience"}},
+	}
+	for i, c := range cases {
+		engine := newEngine()
+		engine.SetStrategy(c.strategy)
+		if err := engine.Eval(); nil != err {
+			t.Error("Eval error: ", err)
+			return
+		}
+		if !reflect.DeepEqual(engine.Fired(), c.expect) {
+			t.Errorf("Case %d fire order error: %v", i, engine.Fired())
+		}
+	}
+}
+
+func TestProductionAttributes(t *testing.T) {
+	count := 0
+	level := 0
+	engine := geval.NewProductionEngine()
+	engine.AddData("count", &count)
+	engine.AddData("level", &level)
+	engine.SetMaxFires(20)
+
+	productions := []geval.Production{
+		{Name: "noLoop", NoLoop: true, When: `count < 100`, Then: `count++`},
+		{Name: "gold", ActivationGroup: "level", Salience: 2, When: `count > 0`, Then: `level = 3`},
+		{Name: "silver", ActivationGroup: "level", Salience: 1, When: `count > 0`, Then: `level = 2`},
+		{Name: "locked", AgendaGroup: "calc", LockOnActive: true, When: `count < 100`, Then: `count = count + 10`},
+		{Name: "bump", AgendaGroup: "calc", Salience: 5, When: `count == 0`, Then: `count = 1`},
+	}
+	for _, production := range productions {
+		if err := engine.AddProduction(production); nil != err {
+			t.Error("Add rule error: ", err)
+			return
+		}
+	}
+	engine.SetFocus("calc")
+	if err := engine.Eval(); nil != err {
+		t.Error("Eval error: ", err)
+		return
+	}
+	t.Log(engine.Fired(), count, level)
+	if !reflect.DeepEqual(engine.Fired(), []string{"bump", "locked", "gold", "noLoop"}) {
+		t.Errorf("Fire order error: %v", engine.Fired())
+		return
+	}
+	if count != 12 || level != 3 {
+		t.Error("Result error")
+	}
+}
+
+func TestHaltAndRetract(t *testing.T) {
+	bill := Bill{Total: 600}
+	coupon := Bill{Discount: 5}
+	count := 0
+	engine := geval.NewProductionEngine()
+	engine.AddData("bill", &bill)
+	engine.AddData("coupon", &coupon)
+	engine.AddData("count", &count)
+
+	engine.AddProduction(geval.Production{Name: "use", Salience: 2, When: `coupon.Discount > 0`, Then: `
+	bill.Discount = coupon.Discount
+	retract(coupon)
+	`})
+	engine.AddProduction(geval.Production{Name: "again", Salience: 1, When: `coupon.Discount > 0`, Then: `bill.Discount = 100`})
+	engine.AddProduction(geval.Production{Name: "stop", When: `count < 100`, Then: `
+	count++
+	if count > 2 {
+		halt()
+	}
+	`})
+
+	if err := engine.Eval(); nil != err {
+		t.Error("Eval error: ", err)
+		return
+	}
+	t.Log(engine.Fired())
+	if bill.Discount != 5 || count != 3 {
+		t.Errorf("Result error, discount: %v, count: %d", bill.Discount, count)
+		return
+	}
+	if _, err := engine.DataCtx().Get("coupon"); nil == err {
+		t.Error("Fact should be retracted")
+	}
+}
+
+func TestProductionBadCondition(t *testing.T) {
+	count := 0
+	engine := geval.NewProductionEngine()
+	for _, when := range []string{"count > 0 }\nfunc g() {", "count > 0; count = 1"} {
+		if err := engine.AddProduction(geval.Production{Name: "bad", When: when}); nil == err {
+			t.Errorf("Condition should be single expression: %q", when)
+			return
+		}
+	}
+
+	for _, when := range []string{`noop()`, `count + 1`} {
+		engine := geval.NewProductionEngine()
+		engine.AddData("count", &count)
+		engine.AddFunc("noop", func() {})
+		if err := engine.AddProduction(geval.Production{Name: "bad", When: when}); nil != err {
+			t.Error("Add production error: ", err)
+			return
+		}
+		err := engine.Eval()
+		if nil == err {
+			t.Errorf("Condition without bool value should fail: %s", when)
+			return
+		}
+		t.Log(err)
+	}
+}
+
+func TestProductionAliasWrite(t *testing.T) {
+	stock := map[string]interface{}{"apple": 0}
+	restocked := false
+	engine := geval.NewProductionEngine()
+	engine.AddData("stock", &stock)
+	engine.AddData("restocked", &restocked)
+	engine.AddProduction(geval.Production{Name: "restock", Salience: 1, When: `stock["apple"] == 0`, Then: "s := stock\ns[\"apple\"] = 10"})
+	engine.AddProduction(geval.Production{Name: "notify", When: `stock["apple"] > 5`, Then: `restocked = true`})
+	if err := engine.Eval(); nil != err || !restocked {
+		t.Errorf("Write through local should make conditions checked again, fired: %v, err: %v", engine.Fired(), err)
+	}
+}
+
+func TestRetractByVariable(t *testing.T) {
+	a, b := 1, 1
+	engine := geval.NewProductionEngine()
+	engine.AddData("a", &a)
+	engine.AddData("b", &b)
+	engine.AddProduction(geval.Production{Name: "local", Salience: 1, When: `a == 1`, Then: "n := 1\nretract(a)"})
+	if err := engine.Eval(); nil != err {
+		t.Error("Retract should not be ambiguous with local of the same value: ", err)
+		return
+	}
+	if _, err := engine.DataCtx().Get("a"); nil == err {
+		t.Error("Fact should be retracted")
+		return
+	}
+	if _, err := engine.DataCtx().Get("n"); nil == err {
+		t.Error("Local of rule should not become fact")
+		return
+	}
+
+	engine.AddProduction(geval.Production{Name: "literal", When: `b == 1`, Then: "n := 7\nretract(7)"})
+	if err := engine.Eval(); nil == err {
+		t.Error("Retract by value should fail")
+		return
+	}
+	if _, err := engine.DataCtx().Get("b"); nil != err {
+		t.Error("Fact should not be retracted by value: ", err)
+	}
+}
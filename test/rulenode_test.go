@@ -3,6 +3,7 @@ package test
 import (
 	"fmt"
 	"math"
+	"reflect"
 	"testing"
 
 	"github.com/MagicYH/geval"
@@ -182,8 +183,6 @@ func TestIf(t *testing.T) {
 		return
 	}
 
-	node.DumpAstTree()
-	return
 	err = node.Eval(dataCtx)
 	if nil != err {
 		t.Error("Eval error: ", err)
@@ -454,3 +453,128 @@ func TestRealEval(t *testing.T) {
 func doubleAssign(a, b int) (int, int) {
 	return a, b
 }
+
+func TestLogic(t *testing.T) {
+	out := make(map[string]interface{})
+	rule := `
+	ok := true
+	out["not"] = !ok
+	out["and"] = ok && !ok
+	out["or"] = !ok || ok
+	out["neg"] = -len("abc")
+	out["short"] = ok || missing
+	`
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("out", &out)
+
+	node, err := geval.NewRuleNode(rule, geval.NewFunCtx())
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+	if err = node.Eval(dataCtx); nil != err {
+		t.Error("Eval error: ", err)
+		return
+	}
+	t.Log(out)
+	if out["not"] != false || out["and"] != false || out["or"] != true || out["neg"] != -3.0 || out["short"] != true {
+		t.Error("Result error")
+	}
+}
+
+func TestLiteral(t *testing.T) {
+	out := make(map[string]interface{})
+	rule := "out[\"hex\"] = 0x1F\n" +
+		"out[\"octal\"] = 0o17\n" +
+		"out[\"binary\"] = 0b101\n" +
+		"out[\"underscore\"] = 1_000\n" +
+		"out[\"escape\"] = \"a\\tb\\n\\u00e9\"\n" +
+		"out[\"raw\"] = `a\\tb`\n" +
+		"out[\"rune\"] = 'é'\n" +
+		"out[\"newline\"] = '\\n'\n" +
+		"out[\"imag\"] = 2i\n"
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("out", &out)
+
+	node, err := geval.NewRuleNode(rule, nil)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+	if err = node.Eval(dataCtx); nil != err {
+		t.Error("Eval error: ", err)
+		return
+	}
+	expect := map[string]interface{}{
+		"hex": 31, "octal": 15, "binary": 5, "underscore": 1000, "escape": "a\tb\né", "raw": `a\tb`,
+		"rune": 'é', "newline": '\n', "imag": complex(0, 2),
+	}
+	for key, value := range expect {
+		if out[key] != value {
+			t.Errorf("%s should be %#v, not %#v", key, value, out[key])
+		}
+	}
+}
+
+func TestStringIndexAndRange(t *testing.T) {
+	s := "héllo"
+	list := []int{1, 2, 3, 4}
+	out := make(map[string]interface{})
+	rule := `
+	out["byte"] = s[0]
+	out["slice"] = s[0:3] + s[3:]
+	out["tail"] = s[len(s)-2:]
+	out["list"] = list[1:3]
+	out["cap"] = len(list[:2:3])
+	runes := 0
+	last := 0
+	for i, r := range s {
+		if r == 'l' {
+			continue
+		}
+		runes++
+		last = i
+	}
+	out["runes"] = runes
+	out["last"] = last
+	sum := 0
+	for _, v := range list {
+		if v > 3 {
+			break
+		}
+		sum = sum + v
+	}
+	out["sum"] = sum
+	`
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("s", &s)
+	dataCtx.Bind("list", &list)
+	dataCtx.Bind("out", &out)
+
+	node, err := geval.NewRuleNode(rule, geval.NewFunCtx())
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+	if err = node.Eval(dataCtx); nil != err {
+		t.Error("Eval error: ", err)
+		return
+	}
+	t.Log(out)
+	if out["byte"] != byte('h') || out["slice"] != s || out["tail"] != "lo" || !reflect.DeepEqual(out["list"], []int{2, 3}) {
+		t.Error("Index and slice error")
+	}
+	if out["cap"] != 2 || out["runes"] != 3.0 || out["last"] != 5 {
+		t.Error("Range over string error")
+	}
+	if out["sum"] != 6.0 {
+		t.Error("Range over slice error")
+	}
+
+	for _, rule := range []string{`out["x"] = s[10]`, `out["x"] = s[3:1]`, `out["x"] = list[1.5]`, `for range 3 {}`, `for k := range out {}`} {
+		node, _ := geval.NewRuleNode(rule, nil)
+		if err := node.Eval(dataCtx); nil == err {
+			t.Errorf("%s should fail", rule)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/MagicYH/geval"
+)
+
+func TestRuleWatcherReload(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.rule": {Data: []byte("// @priority: 1\nout = out + \"a\"\n")},
+		"b.rule": {Data: []byte("// @priority: 2\nout = out + \"b\"\n")},
+	}
+	watcher, err := geval.NewRuleWatcher(fsys, nil)
+	if nil != err {
+		t.Error("New watcher error: ", err)
+		return
+	}
+
+	out := ""
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("out", &out)
+	first := watcher.Current()
+	if err = first.Eval(dataCtx); nil != err || out != "ba" {
+		t.Errorf("Eval set error: %v, out: %s", err, out)
+		return
+	}
+
+	if swapped, _ := watcher.Reload(); swapped {
+		t.Error("Set should not be swapped if files not changed")
+		return
+	}
+
+	fsys["c.rule"] = &fstest.MapFile{Data: []byte("out = \n")}
+	if swapped, err := watcher.Reload(); swapped || nil == err {
+		t.Error("Broken set should not be swapped")
+		return
+	}
+	if watcher.Current() != first {
+		t.Error("Previous set should be kept")
+		return
+	}
+
+	fsys["c.rule"] = &fstest.MapFile{Data: []byte("out = out + \"c\"\n")}
+	if swapped, err := watcher.Reload(); !swapped || nil != err {
+		t.Error("New set should be swapped: ", err)
+		return
+	}
+	second := watcher.Current()
+	if second.Version() != 2 || len(second.Rules()) != 3 || len(first.Rules()) != 2 {
+		t.Error("Swapped set error")
+		return
+	}
+	if _, ok := second.Get("c"); !ok {
+		t.Error("Get rule error")
+	}
+}
+
+func TestRuleWatcherWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "geval")
+	if nil != err {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "a.rule"), []byte("a = 1\n"), 0644)
+
+	watcher, err := geval.NewRuleWatcher(os.DirFS(dir), nil)
+	if nil != err {
+		t.Error("New watcher error: ", err)
+		return
+	}
+	swapped := make(chan *geval.RuleSet, 1)
+	watcher.OnSwap(func(old *geval.RuleSet, new *geval.RuleSet) {
+		swapped <- new
+	})
+	watcher.Watch(10*time.Millisecond, nil)
+	defer watcher.Stop()
+
+	ioutil.WriteFile(filepath.Join(dir, "b.rule"), []byte("b = 1\n"), 0644)
+	select {
+	case set := <-swapped:
+		if len(set.Rules()) != 2 || watcher.Current() != set {
+			t.Error("Watched set error")
+		}
+	case <-time.After(time.Second):
+		t.Error("Change should be picked up by watcher")
+	}
+}
+
+// TestRuleSetConcurrentEval : Run with -race, a set is shared by goroutines while a new one is swapped in
+func TestRuleSetConcurrentEval(t *testing.T) {
+	fsys := fstest.MapFS{
+		"size.rule": {Data: []byte("x := n * 2\nif x > 10 {\n\tout = \"big\"\n} else {\n\tout = \"small\"\n}\n")},
+	}
+	watcher, err := geval.NewRuleWatcher(fsys, nil)
+	if nil != err {
+		t.Error("New watcher error: ", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			out := ""
+			dataCtx := geval.NewDataCtx()
+			dataCtx.Bind("n", &n)
+			dataCtx.Bind("out", &out)
+			expect := "small"
+			if n*2 > 10 {
+				expect = "big"
+			}
+			for j := 0; j < 200; j++ {
+				if err := watcher.Current().Eval(dataCtx); nil != err || out != expect {
+					errs <- fmt.Errorf("n: %d, out: %s, err: %v", n, out, err)
+					return
+				}
+			}
+		}(i)
+	}
+
+	fsys["size.rule"] = &fstest.MapFile{Data: []byte("x := n * 2\nout = \"small\"\nif x > 10 {\n\tout = \"big\"\n}\n")}
+	if swapped, err := watcher.Reload(); !swapped || nil != err {
+		t.Error("New set should be swapped: ", err)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error("Concurrent eval error: ", err)
+	}
+}
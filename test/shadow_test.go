@@ -0,0 +1,148 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/MagicYH/geval"
+)
+
+func TestEvalResult(t *testing.T) {
+	node, err := geval.NewRuleNode(`
+	for i := 0; i < 10; i++ {
+		if i > 2 {
+			return i, "stop"
+		}
+	}
+	return -1, "end"
+	`, nil)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+	result, err := node.EvalResult(geval.NewDataCtx())
+	if nil != err {
+		t.Error("Eval error: ", err)
+		return
+	}
+	if len(result) != 2 || result[0] != 3.0 || result[1] != "stop" {
+		t.Errorf("Return value error: %v", result)
+	}
+}
+
+func TestDataContextClone(t *testing.T) {
+	dict := map[string]interface{}{"sub": map[string]interface{}{"int": 1}, "list": []int{1, 2}}
+	person := &Person{Name: "Lilei"}
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("dict", &dict)
+	dataCtx.Bind("person", &person)
+
+	node, _ := geval.NewRuleNode(`
+	dict["sub"]["int"] = 2
+	dict["list"][0] = 10
+	person.Name = "Hanmeimei"
+	`, nil)
+	clone := dataCtx.Clone()
+	if err := node.Eval(clone); nil != err {
+		t.Error("Eval error: ", err)
+		return
+	}
+	if dict["sub"].(map[string]interface{})["int"] != 1 || dict["list"].([]int)[0] != 1 || person.Name != "Lilei" {
+		t.Error("Write to clone should not change origin data")
+		return
+	}
+	value, _ := clone.Get("person")
+	if (*value.(**Person)).Name != "Hanmeimei" {
+		t.Error("Clone should be written")
+	}
+}
+
+func TestEvalShadow(t *testing.T) {
+	base := 100
+	price := 0
+	dataCtx := geval.NewDataCtx()
+	dataCtx.BindReadOnly("base", &base)
+	dataCtx.Bind("price", &price)
+
+	primary, _ := geval.NewRuleNode(`
+	rate := 2
+	price = base * rate
+	return "v1"
+	`, nil)
+	candidate, _ := geval.NewRuleNode(`
+	price = base * 2
+	return "v1"
+	`, nil)
+
+	report, err := geval.EvalShadow(primary, candidate, dataCtx, func(report *geval.ShadowReport) {
+		t.Error("Same effects should not diverge: ", report.Divergences)
+	})
+	if nil != err || price != 200 || len(report.PrimaryChanges) != 2 {
+		t.Error("Primary should be run on live data: ", err)
+		return
+	}
+
+	price = 0
+	candidate, _ = geval.NewRuleNode(`
+	price = base * 3
+	return "v2"
+	`, nil)
+	var diverged *geval.ShadowReport
+	geval.EvalShadow(primary, candidate, dataCtx, func(report *geval.ShadowReport) {
+		diverged = report
+	})
+	if price != 200 {
+		t.Error("Candidate should not write live data")
+		return
+	}
+	if nil == diverged || len(diverged.Divergences) != 2 {
+		t.Error("Divergence should be reported")
+		return
+	}
+	t.Log(diverged.Divergences)
+	if d := diverged.Divergences[0]; d.Path != "price" || d.Primary != 200.0 || d.Candidate != 300.0 {
+		t.Errorf("Write divergence error: %v", d)
+	}
+	if d := diverged.Divergences[1]; d.Path != "return" {
+		t.Errorf("Return divergence error: %v", d)
+	}
+}
+
+func TestEvalShadowPrimaryError(t *testing.T) {
+	price := 0
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("price", &price)
+
+	primary, _ := geval.NewRuleNode(`
+	price = 10
+	price = missing
+	`, nil)
+	candidate, _ := geval.NewRuleNode(`
+	price = 10
+	`, nil)
+	report, err := geval.EvalShadow(primary, candidate, dataCtx, nil)
+	if nil == err {
+		t.Error("Error of primary should be returned")
+		return
+	}
+	// like Eval, writes before the error are kept
+	if price != 10 || len(report.PrimaryChanges) != 1 || report.PrimaryChanges[0].New != 10 {
+		t.Errorf("Partial writes of primary should be kept, price: %d, changes: %v", price, report.PrimaryChanges)
+		return
+	}
+	if len(report.Divergences) != 1 || report.Divergences[0].Path != "error" {
+		t.Errorf("Only error should diverge: %v", report.Divergences)
+	}
+}
+
+func TestEvalShadowAlias(t *testing.T) {
+	dict := map[string]interface{}{"price": 1}
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("dict", &dict)
+
+	primary, _ := geval.NewRuleNode("m := dict\nm[\"price\"] = 10", nil)
+	candidate, _ := geval.NewRuleNode("m := dict\nm[\"price\"] = 12", nil)
+	report, _ := geval.EvalShadow(primary, candidate, dataCtx, nil)
+	if len(report.Divergences) != 1 || report.Divergences[0].Path != `dict["price"]` {
+		t.Errorf("Write through local should be compared: %v", report.Divergences)
+	}
+}
@@ -0,0 +1,157 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MagicYH/geval"
+)
+
+type Shipment struct {
+	Placed  time.Time
+	Expires time.Time
+	Window  time.Duration
+}
+
+func TestTime(t *testing.T) {
+	clock := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	shipment := Shipment{Placed: time.Date(2024, 2, 10, 8, 0, 0, 0, time.UTC)}
+	recent, expired := false, false
+	var age time.Duration
+	var hours float64
+
+	dataCtx := geval.NewDataCtx()
+	dataCtx.SetClock(func() time.Time { return clock })
+	dataCtx.Bind("order", &shipment)
+	dataCtx.Bind("recent", &recent)
+	dataCtx.Bind("expired", &expired)
+	dataCtx.Bind("age", &age)
+	dataCtx.Bind("hours", &hours)
+
+	rule := `
+	order.Window = 30 * time.Day
+	order.Expires = order.Placed + order.Window - 12*time.Hour
+	recent = now() - order.Placed < order.Window
+	expired = time.Now() > order.Expires
+	age = time.Since(order.Placed)
+	hours = (order.Expires - order.Placed) / time.Hour
+	`
+	funCtx := geval.NewFunCtx()
+	if err := funCtx.BindTimePackage(); nil != err {
+		t.Error("Bind time package error: ", err)
+		return
+	}
+	node, err := geval.NewRuleNode(rule, funCtx)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+	if err = node.Eval(dataCtx); nil != err {
+		t.Error("Eval error: ", err)
+		return
+	}
+	if shipment.Window != 30*24*time.Hour || !shipment.Expires.Equal(time.Date(2024, 3, 10, 20, 0, 0, 0, time.UTC)) {
+		t.Errorf("Time math error: %+v", shipment)
+	}
+	if !recent || expired || age != 20*24*time.Hour+4*time.Hour || hours != 30*24-12 {
+		t.Errorf("Result error, recent: %v, expired: %v, age: %v, hours: %v", recent, expired, age, hours)
+	}
+
+	clock = clock.Add(15 * 24 * time.Hour)
+	if err = node.Eval(dataCtx); nil != err || recent || !expired {
+		t.Errorf("Clock should be read in every eval, recent: %v, expired: %v, err: %v", recent, expired, err)
+	}
+
+	for _, rule := range []string{`age = order.Placed + order.Placed`, `recent = order.Placed < 1`, `age = time.Hour / 0`, `age = time.Hour + 0.5`} {
+		node, _ := geval.NewRuleNode(rule, funCtx)
+		if err := node.Eval(dataCtx); nil == err {
+			t.Errorf("%s should fail", rule)
+		}
+	}
+}
+
+func TestDurationMath(t *testing.T) {
+	funCtx := geval.NewFunCtx()
+	funCtx.BindTimePackage()
+	// big + 1 is lost if math is done in float64
+	big := time.Duration(1 << 62)
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("big", &big)
+	node, err := geval.NewRuleNode(`
+	d := time.Hour
+	d++
+	d--
+	d--
+	return 90*time.Minute/time.Hour, 1.5*time.Hour, time.Hour/4.0, big+1, 1+big, time.Hour*2-time.Second, -big, d, time.Now() + -time.Hour < time.Now()
+	`, funCtx)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+	result, err := node.EvalResult(dataCtx)
+	if nil != err {
+		t.Error("Eval error: ", err)
+		return
+	}
+	expect := []interface{}{time.Duration(1), 90 * time.Minute, 15 * time.Minute, big + 1, big + 1, 2*time.Hour - time.Second, -big, time.Hour - 1, true}
+	for i := range expect {
+		if result[i] != expect[i] {
+			t.Errorf("Result %d error: %v, expect: %v", i, result[i], expect[i])
+		}
+	}
+}
+
+func TestTimePackageOptIn(t *testing.T) {
+	when := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	out := make(map[string]interface{})
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("out", &out)
+	dataCtx.BindValue("time", map[string]interface{}{"zone": "UTC"})
+	funCtx := geval.NewFunCtx()
+	if err := funCtx.Bind("now", func() time.Time { return when }); nil != err {
+		t.Error("Func now should not be bound by default: ", err)
+		return
+	}
+	funCtx.Bind("stamp", func(ctx *geval.DataContext, name string) string { return name })
+	funCtx.BindWithContext("clock", func(ctx *geval.DataContext) time.Time { return ctx.Now() })
+
+	node, err := geval.NewRuleNode(`
+	out["zone"] = time["zone"]
+	out["now"] = now()
+	out["stamp"] = stamp(nil, "a")
+	`, funCtx)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+	if err = node.Eval(dataCtx); nil != err {
+		t.Error("Eval error: ", err)
+		return
+	}
+	if out["zone"] != "UTC" || out["now"] != when || out["stamp"] != "a" {
+		t.Errorf("Data variable time and user func should work without time package: %v", out)
+		return
+	}
+
+	dataCtx.SetClock(func() time.Time { return when })
+	node, _ = geval.NewRuleNode(`out["clock"] = clock()`, funCtx)
+	if err = node.Eval(dataCtx); nil != err || out["clock"] != when {
+		t.Errorf("Func bound with context should get context, out: %v, err: %v", out, err)
+	}
+
+	if err = funCtx.BindWithContext("bad", func(name string) {}); nil == err {
+		t.Error("Func without *DataContext param should not be bound with context")
+	}
+	if err = funCtx.BindTimePackage(); nil == err {
+		t.Error("Bind time package should fail when now is bound")
+	}
+
+	node, err = geval.NewRuleNode("time := 2\nreturn time", geval.NewFunCtx())
+	if nil != err {
+		t.Error("Variable time should be allowed without time package: ", err)
+		return
+	}
+	if result, err := node.EvalResult(geval.NewDataCtx()); nil != err || result[0] != 2 {
+		t.Errorf("Variable time error, result: %v, err: %v", result, err)
+	}
+}
@@ -0,0 +1,103 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/MagicYH/geval"
+)
+
+type Item struct {
+	Price float64
+}
+
+type Order struct {
+	Items []Item
+	Total float64
+}
+
+func TestEvalTrace(t *testing.T) {
+	order := Order{Items: []Item{{Price: 1}, {Price: 2}, {Price: 3}}}
+	dict := map[string]interface{}{"sub": map[string]interface{}{"int": 1}}
+	idx := 2
+	rule := `
+	tmp := order.Items[idx].Price
+	dict["sub"]["int"] = tmp
+	order.Total = order.Items[0].Price + tmp
+	`
+
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("order", &order)
+	dataCtx.Bind("dict", &dict)
+	dataCtx.Bind("idx", &idx)
+
+	node, err := geval.NewRuleNode(rule, nil)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+
+	trace, err := node.EvalTrace(dataCtx)
+	if nil != err {
+		t.Error("Eval error: ", err)
+		return
+	}
+	t.Log(trace)
+
+	expectReads := []string{"idx", "order.Items[2].Price", "order.Items[0].Price"}
+	expectWrites := []string{`dict["sub"]["int"]`, "order.Total"}
+	if !reflect.DeepEqual(trace.Reads, expectReads) || !reflect.DeepEqual(trace.Writes, expectWrites) {
+		t.Error("Trace result error")
+		return
+	}
+
+	deps := node.Dependencies()
+	t.Log(deps)
+	expectReads = []string{"idx", "order.Items[*].Price", "order.Items[0].Price"}
+	if !reflect.DeepEqual(deps.Reads, expectReads) || !reflect.DeepEqual(deps.Writes, expectWrites) {
+		t.Error("Dependencies result error")
+	}
+}
+
+func TestTraceAlias(t *testing.T) {
+	dict := map[string]interface{}{"k": 1, "sub": map[string]interface{}{"int": 1}}
+	list := []map[string]int{{"a": 1}}
+	total := 0
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("dict", &dict)
+	dataCtx.Bind("list", &list)
+	dataCtx.Bind("total", &total)
+
+	node, err := geval.NewRuleNode(`
+	m := dict
+	m["k"] = 2
+	sub := m["sub"]
+	sub["int"] = 2
+	for _, v := range list {
+		v["a"] = 2
+	}
+	n := total
+	n = 3
+	`, nil)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+	trace, err := node.EvalTrace(dataCtx)
+	if nil != err {
+		t.Error("Eval error: ", err)
+		return
+	}
+	t.Log(trace)
+	expectWrites := []string{`dict["k"]`, `dict["sub"]["int"]`, `list[0]["a"]`}
+	if !reflect.DeepEqual(trace.Writes, expectWrites) {
+		t.Errorf("Writes through local should be traced under bound data: %v", trace.Writes)
+	}
+
+	deps := node.Dependencies()
+	t.Log(deps)
+	expectWrites = []string{`dict["k"]`, `dict["sub"]["int"]`, `list[*]["a"]`}
+	if !reflect.DeepEqual(deps.Writes, expectWrites) {
+		t.Errorf("Dependencies should include writes through local: %v", deps.Writes)
+	}
+}
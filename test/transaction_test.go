@@ -0,0 +1,131 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/MagicYH/geval"
+)
+
+func TestEvalTxRollback(t *testing.T) {
+	dict := map[string]interface{}{"int": 10, "sub": map[string]interface{}{"int": 2}}
+	list := []int{1, 2, 3}
+	value := 0
+	stru := Person{Name: "Lilei"}
+	rule := `
+	value = 10
+	dict["int"] = 1
+	dict["new"] = 1
+	dict["sub"]["int"] = 1
+	list[1] = 20
+	stru.Name = "Hanmeimei"
+	stru.Pro.Salary = 100
+	stru.Age = "not int"
+	`
+
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("dict", &dict)
+	dataCtx.Bind("list", &list)
+	dataCtx.Bind("value", &value)
+	dataCtx.Bind("stru", &stru)
+
+	node, err := geval.NewRuleNode(rule, nil)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+
+	_, err = node.EvalTx(dataCtx)
+	if nil == err {
+		t.Error("Eval should fail")
+		return
+	}
+	t.Log(err)
+
+	t.Log(dict, list, value, stru)
+	if value != 0 || dict["int"] != 10 || dict["sub"].(map[string]interface{})["int"] != 2 || list[1] != 2 {
+		t.Error("Rollback error")
+		return
+	}
+	if _, ok := dict["new"]; ok {
+		t.Error("New key should be deleted by rollback")
+		return
+	}
+	if stru.Name != "Lilei" || stru.Pro.Salary != 0 {
+		t.Error("Rollback struct error")
+	}
+}
+
+func TestEvalTxCommit(t *testing.T) {
+	dict := map[string]interface{}{"int": 10}
+	value := 0
+	rule := `
+	tmp := 1
+	value = 10
+	dict["int"] = 1
+	dict["new"] = "str"
+	`
+
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("dict", &dict)
+	dataCtx.Bind("value", &value)
+
+	node, err := geval.NewRuleNode(rule, nil)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+
+	changes, err := node.EvalTx(dataCtx)
+	if nil != err {
+		t.Error("Eval error: ", err)
+		return
+	}
+	t.Log(changes)
+
+	expect := []geval.Change{
+		{Path: "tmp", Old: nil, New: 1},
+		{Path: "value", Old: 0, New: 10},
+		{Path: `dict["int"]`, Old: 10, New: 1},
+		{Path: `dict["new"]`, Old: nil, New: "str"},
+	}
+	if len(changes) != len(expect) {
+		t.Error("Change number error")
+		return
+	}
+	for i, change := range changes {
+		if change != expect[i] {
+			t.Errorf("Change error, expect: %v, real: %v", expect[i], change)
+			return
+		}
+	}
+	if value != 10 || dict["new"] != "str" {
+		t.Error("Commit error")
+	}
+}
+
+func TestEvalTxFloatIndex(t *testing.T) {
+	list := []int{1, 2, 3}
+	// number decoded from JSON is float64
+	dataCtx := geval.NewDataCtx()
+	dataCtx.Bind("list", &list)
+	dataCtx.BindJSON("payload", []byte(`{"i": 1}`))
+
+	node, err := geval.NewRuleNode("i := payload.i\nlist[i] = 9\ni = i + 1\nlist[i] = 9\nlist[9] = 1", nil)
+	if nil != err {
+		t.Error("New rule error: ", err)
+		return
+	}
+	if _, err = node.EvalTx(dataCtx); nil == err {
+		t.Error("Eval should fail")
+		return
+	}
+	if list[1] != 2 || list[2] != 3 {
+		t.Errorf("Set by float index should be rolled back: %v", list)
+		return
+	}
+
+	node, _ = geval.NewRuleNode("i := payload.i\ni = i + 1\nlist[i] = 9", nil)
+	if err = node.Eval(dataCtx); nil != err || list[2] != 9 {
+		t.Errorf("Float without fraction should be index, list: %v, err: %v", list, err)
+	}
+}
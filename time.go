@@ -0,0 +1,160 @@
+package geval
+
+import (
+	"errors"
+	"fmt"
+	"go/token"
+	"math"
+	"reflect"
+	"time"
+)
+
+// BindTimePackage : Bind function `now` and package `time` with duration constants like `time.Hour`,
+// `now`, `time.Now`, `time.Since` and `time.Until` read the clock set by DataContext.SetClock
+func (ctx *FunContext) BindTimePackage() error {
+	if _, ok := ctx.pkgs["time"]; ok {
+		return errors.New("Package 'time' have bind before")
+	}
+	if _, ok := ctx.data["time"]; ok {
+		return errors.New("Package 'time' collides with func 'time'")
+	}
+	if err := ctx.BindWithContext("now", buildInNow); nil != err {
+		return err
+	}
+	// constants are not allowed by BindPackage, set members directly
+	ctx.pkgs["time"] = timePackage()
+	return nil
+}
+
+// timePackage : Members of package `time`, functions reading clock take DataContext of the running rule
+func timePackage() map[string]interface{} {
+	return map[string]interface{}{
+		"Nanosecond":    time.Nanosecond,
+		"Microsecond":   time.Microsecond,
+		"Millisecond":   time.Millisecond,
+		"Second":        time.Second,
+		"Minute":        time.Minute,
+		"Hour":          time.Hour,
+		"Day":           24 * time.Hour,
+		"UTC":           time.UTC,
+		"RFC3339":       time.RFC3339,
+		"DateOnly":      "2006-01-02",
+		"Now":           ctxFunc{buildInNow},
+		"Since":         ctxFunc{buildInSince},
+		"Until":         ctxFunc{buildInUntil},
+		"Parse":         time.Parse,
+		"ParseDuration": time.ParseDuration,
+		"Unix":          time.Unix,
+		"Date":          time.Date,
+	}
+}
+
+// buildInNow : now, current time of clock set to DataContext
+func buildInNow(ctx *DataContext) time.Time {
+	return ctx.Now()
+}
+
+func buildInSince(ctx *DataContext, t time.Time) time.Duration {
+	return ctx.Now().Sub(t)
+}
+
+func buildInUntil(ctx *DataContext, t time.Time) time.Duration {
+	return t.Sub(ctx.Now())
+}
+
+// timeMath : Math on time.Time and time.Duration keep their types and is done in int64, like Go. Time minus
+// time is duration, time plus duration is time, duration divided by duration and duration multiplied by
+// number are duration
+func timeMath(a, b interface{}, op token.Token) (ret interface{}, ok bool, err error) {
+	ta, isTimeA := a.(time.Time)
+	tb, isTimeB := b.(time.Time)
+	da, isDurA := a.(time.Duration)
+	db, isDurB := b.(time.Duration)
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch {
+	case isTimeA && isTimeB && token.SUB == op:
+		return ta.Sub(tb), true, nil
+	case isTimeA && isDurB && (token.ADD == op || token.SUB == op):
+		if token.SUB == op {
+			db = -db
+		}
+		return ta.Add(db), true, nil
+	case isDurA && isTimeB && token.ADD == op:
+		return tb.Add(da), true, nil
+	case isTimeA || isTimeB:
+		return nil, true, fmt.Errorf("Operator %s not defined on %T and %T", op, a, b)
+	case isDurA && isDurB:
+		switch op {
+		case token.ADD:
+			return da + db, true, nil
+		case token.SUB:
+			return da - db, true, nil
+		case token.MUL:
+			return da * db, true, nil
+		case token.QUO:
+			if 0 == db {
+				return nil, true, errors.New("Can not div with zero(0) value")
+			}
+			return da / db, true, nil
+		}
+	case isDurA && isNumberValue(vb):
+		ret, err = durationMath(da, vb, op)
+		return ret, true, err
+	case isDurB && isNumberValue(va) && (token.ADD == op || token.MUL == op):
+		ret, err = durationMath(db, va, op)
+		return ret, true, err
+	}
+	return nil, false, nil
+}
+
+// durationMath : Math of duration and number. Integer and float without fraction are taken as int64,
+// float with fraction can only scale the duration, the result is rounded to nanosecond
+func durationMath(d time.Duration, v reflect.Value, op token.Token) (time.Duration, error) {
+	var n int64
+	exact := true
+	switch numClass(v.Kind()) {
+	case 'i':
+		n = v.Int()
+	case 'u':
+		n = int64(v.Uint())
+	default:
+		f := v.Float()
+		exact = f == math.Trunc(f) && math.Abs(f) < math.MaxInt64
+		n = int64(f)
+	}
+
+	if !exact {
+		switch op {
+		case token.MUL:
+			return time.Duration(math.Round(float64(d) * v.Float())), nil
+		case token.QUO:
+			return time.Duration(math.Round(float64(d) / v.Float())), nil
+		}
+		return 0, fmt.Errorf("Operator %s not defined on time.Duration and %v", op, v.Float())
+	}
+
+	switch op {
+	case token.ADD:
+		return d + time.Duration(n), nil
+	case token.SUB:
+		return d - time.Duration(n), nil
+	case token.MUL:
+		return d * time.Duration(n), nil
+	case token.QUO:
+		if 0 == n {
+			return 0, errors.New("Can not div with zero(0) value")
+		}
+		return d / time.Duration(n), nil
+	}
+	return 0, fmt.Errorf("Operator %s not defined on time.Duration", op)
+}
+
+// cmpTime : Compare time by instant, location and monotonic clock are ignored
+func cmpTime(a, b interface{}) (r int, ok bool) {
+	ta, isTimeA := a.(time.Time)
+	tb, isTimeB := b.(time.Time)
+	if !isTimeA || !isTimeB {
+		return 0, false
+	}
+	return cmpOrdered(ta.Before(tb), ta.After(tb)), true
+}
@@ -0,0 +1,363 @@
+package geval
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// Trace : Access paths a rule read and wrote, like `order.Items[2].Price` or `dict["sub"]["int"]`.
+// A read path is dropped if it is the prefix of another accessed path, variables defined in rule by `:=`
+// are not included, access through them is reported under the bound data they are assigned from,
+// like `dict["k"]` for `m["k"]` after `m := dict`
+type Trace struct {
+	Reads  []string
+	Writes []string
+}
+
+// tracer : Collect access paths during eval
+type tracer struct {
+	locals map[string]bool
+	reads  pathSet
+	writes pathSet
+}
+
+// pathSet : Set of path keep insert order
+type pathSet struct {
+	list []string
+	seen map[string]bool
+}
+
+func (set *pathSet) add(path string) {
+	if nil == set.seen {
+		set.seen = make(map[string]bool)
+	}
+	if set.seen[path] {
+		return
+	}
+	set.seen[path] = true
+	set.list = append(set.list, path)
+}
+
+// EvalTrace : Run a node and report which paths it read and wrote
+func (ruleNode *RuleNode) EvalTrace(dataCtx *DataContext) (*Trace, error) {
+	t := &tracer{locals: ruleNode.locals()}
+	ev := ruleNode.newEvaluator(dataCtx)
+	ev.tracer = t
+	ev.locals = t.locals
+
+	err := ev.run()
+	return newTrace(t.reads.list, t.writes.list), err
+}
+
+// Dependencies : Derive possible read and write paths from ast without running the rule.
+// Index that can not be known before eval is written as `[*]`
+func (ruleNode *RuleNode) Dependencies() *Trace {
+	locals := ruleNode.localAliases()
+	reads := pathSet{}
+	writes := pathSet{}
+
+	var visitExpr func(expr ast.Expr)
+	addPath := func(set *pathSet, expr ast.Expr) {
+		path := locals.dataPath(ruleNode.staticPath(expr, visitExpr), set == &writes)
+		if "" != path {
+			set.add(path)
+		}
+	}
+	visitExpr = func(expr ast.Expr) {
+		switch n := expr.(type) {
+		case nil:
+		case *ast.Ident, *ast.IndexExpr, *ast.SelectorExpr:
+			addPath(&reads, n)
+		case *ast.ArrayType, *ast.MapType:
+			// type expression, no data
+		case *ast.CompositeLit:
+			for _, elt := range n.Elts {
+				visitExpr(elt)
+			}
+		case *ast.CallExpr:
+			switch fun := n.Fun.(type) {
+			case *ast.SelectorExpr:
+				if !ruleNode.isPackageSel(fun) {
+					// method receiver is read
+					addPath(&reads, fun.X)
+				}
+			case *ast.Ident:
+			default:
+				visitExpr(fun)
+			}
+			for _, arg := range n.Args {
+				visitExpr(arg)
+				// function may change map, slice or struct pointer passed to it
+				if path := locals.dataPath(ruleNode.staticPath(arg, func(ast.Expr) {}), false); "" != path {
+					writes.add(path)
+				}
+			}
+		default:
+			ast.Inspect(n, func(node ast.Node) bool {
+				if node == n {
+					return true
+				}
+				if sub, ok := node.(ast.Expr); ok {
+					visitExpr(sub)
+					return false
+				}
+				return true
+			})
+		}
+	}
+
+	var inspect func(node ast.Node) bool
+	inspect = func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.RangeStmt:
+			if token.ASSIGN == n.Tok {
+				for _, expr := range []ast.Expr{n.Key, n.Value} {
+					addPath(&writes, expr)
+				}
+			}
+			visitExpr(n.X)
+			ast.Inspect(n.Body, inspect)
+			return false
+		case *ast.AssignStmt:
+			for _, expr := range n.Lhs {
+				addPath(&writes, expr)
+				if token.ASSIGN != n.Tok && token.DEFINE != n.Tok {
+					// `a += 1` read a too
+					addPath(&reads, expr)
+				}
+			}
+			for _, expr := range n.Rhs {
+				visitExpr(expr)
+			}
+			return false
+		case *ast.IncDecStmt:
+			addPath(&reads, n.X)
+			addPath(&writes, n.X)
+			return false
+		case ast.Expr:
+			visitExpr(n)
+			return false
+		}
+		return true
+	}
+	ast.Inspect(ruleNode.astFile.Decls[0].(*ast.FuncDecl).Body, inspect)
+
+	return newTrace(reads.list, writes.list)
+}
+
+// staticPath : Path of expr with literal index, visit is called for expressions used as index
+func (ruleNode *RuleNode) staticPath(expr ast.Expr, visit func(ast.Expr)) string {
+	switch n := expr.(type) {
+	case *ast.Ident:
+		return identPath(n)
+	case *ast.ParenExpr:
+		return ruleNode.staticPath(n.X, visit)
+	case *ast.IndexExpr:
+		visit(n.Index)
+		index := "[*]"
+		if lit, ok := n.Index.(*ast.BasicLit); ok {
+			if value, err := ruleNode.evalBasicLit(lit); nil == err {
+				index = indexPath(value)
+			}
+		}
+		return joinPath(ruleNode.staticPath(n.X, visit), index)
+	case *ast.SelectorExpr:
+		if ruleNode.isPackageSel(n) {
+			return ""
+		}
+		return joinPath(ruleNode.staticPath(n.X, visit), "."+n.Sel.Name)
+	default:
+		visit(expr)
+		return ""
+	}
+}
+
+// locals : Variables defined in rule by `:=`, including keys and values of range
+func (ruleNode *RuleNode) locals() map[string]bool {
+	locals := make(map[string]bool)
+	ast.Inspect(ruleNode.astFile, func(node ast.Node) bool {
+		var lhs []ast.Expr
+		switch n := node.(type) {
+		case *ast.AssignStmt:
+			if token.DEFINE == n.Tok {
+				lhs = n.Lhs
+			}
+		case *ast.RangeStmt:
+			if token.DEFINE == n.Tok {
+				lhs = []ast.Expr{n.Key, n.Value}
+			}
+		}
+		for _, expr := range lhs {
+			if ident, ok := expr.(*ast.Ident); ok {
+				locals[ident.Name] = true
+			}
+		}
+		return true
+	})
+	return locals
+}
+
+// staticLocals : Local variables of rule, and paths of bound data they are assigned from, for analysis
+// without running the rule
+type staticLocals struct {
+	names   map[string]bool
+	aliases map[string]string
+}
+
+// localAliases : Find locals assigned from bound data, like `m := dict` or `for _, v := range list`.
+// The local is taken as the data wherever it is used, even if it is assigned with other value later
+func (ruleNode *RuleNode) localAliases() *staticLocals {
+	locals := &staticLocals{names: ruleNode.locals(), aliases: make(map[string]string)}
+	noVisit := func(ast.Expr) {}
+	alias := func(lhs ast.Expr, path string) {
+		ident, ok := lhs.(*ast.Ident)
+		if !ok || !locals.names[ident.Name] {
+			return
+		}
+		if path = locals.dataPath(path, false); "" != path {
+			locals.aliases[ident.Name] = path
+		}
+	}
+	ast.Inspect(ruleNode.astFile, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.AssignStmt:
+			if len(n.Lhs) == len(n.Rhs) {
+				for i, lhs := range n.Lhs {
+					alias(lhs, ruleNode.staticPath(n.Rhs[i], noVisit))
+				}
+			}
+		case *ast.RangeStmt:
+			if nil != n.Value {
+				alias(n.Value, joinPath(ruleNode.staticPath(n.X, noVisit), "[*]"))
+			}
+		}
+		return true
+	})
+	return locals
+}
+
+// dataPath : Path of bound data accessed by path, path through local assigned from bound data is
+// rewritten under the data. Empty if path is local, or is an assignment to local variable itself
+func (locals *staticLocals) dataPath(path string, write bool) string {
+	if "" == path {
+		return ""
+	}
+	root := pathRoot(path)
+	if !locals.names[root] {
+		return path
+	}
+	alias, ok := locals.aliases[root]
+	if !ok || write && root == path {
+		return ""
+	}
+	// alias is resolved when it is added, no loop here
+	return alias + path[len(root):]
+}
+
+func (ev *evaluator) tracking() bool {
+	return nil != ev.tracer || nil != ev.undoLog
+}
+
+// traceRead : Remember path of the value just read, and record it if tracer is set
+func (ev *evaluator) traceRead(path string) {
+	ev.lastPath = path
+	if nil != ev.tracer && "" != path && !ev.tracer.locals[pathRoot(path)] {
+		ev.tracer.reads.add(path)
+	}
+}
+
+func (ev *evaluator) traceWrite(path string) {
+	if nil != ev.tracer && "" != path && !ev.tracer.locals[pathRoot(path)] {
+		ev.tracer.writes.add(path)
+	}
+}
+
+func newTrace(reads []string, writes []string) *Trace {
+	trace := &Trace{Writes: writes}
+	for _, read := range reads {
+		if !hasSubPath(read, reads) && !hasSubPath(read, writes) {
+			trace.Reads = append(trace.Reads, read)
+		}
+	}
+	return trace
+}
+
+// hasSubPath : Check if any path in list is under prefix, `a.b` and `a["b"]` are under `a`
+func hasSubPath(prefix string, list []string) bool {
+	for _, path := range list {
+		if len(path) > len(prefix) && strings.HasPrefix(path, prefix) && isPathSep(path[len(prefix)]) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitPath : Split `a.b["c"][*]` to `a`, `.b`, `["c"]`, `[*]`
+func splitPath(path string) (elems []string) {
+	start := 0
+	inQuote := false
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case inQuote && '\\' == c:
+			i++
+		case '"' == c:
+			inQuote = !inQuote
+		case !inQuote && isPathSep(c) && i > start:
+			elems = append(elems, path[start:i])
+			start = i
+		}
+	}
+	return append(elems, path[start:])
+}
+
+func pathRoot(path string) string {
+	return splitPath(path)[0]
+}
+
+func isPathSep(c byte) bool {
+	return '.' == c || '[' == c
+}
+
+func joinPath(base string, elem string) string {
+	if "" == base {
+		return ""
+	}
+	return base + elem
+}
+
+func identPath(node *ast.Ident) string {
+	switch node.Name {
+	case "true", "false", "nil", "_":
+		return ""
+	}
+	return node.Name
+}
+
+// pathOverlap : Check if two paths may access the same data, it is true if one is under the other.
+// `[*]` match any index, `.key` and `["key"]` are the same since map key can be read by selector
+func pathOverlap(a string, b string) bool {
+	elemsA, elemsB := splitPath(a), splitPath(b)
+	for i := 0; i < len(elemsA) && i < len(elemsB); i++ {
+		ea, eb := selElem(elemsA[i]), selElem(elemsB[i])
+		switch {
+		case ea == eb:
+		case "[*]" == ea && 0 != i, "[*]" == eb && 0 != i:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// selElem : Write string index `["key"]` as `.key`
+func selElem(elem string) string {
+	if strings.HasPrefix(elem, `["`) {
+		if key, err := strconv.Unquote(elem[1 : len(elem)-1]); nil == err && token.IsIdentifier(key) {
+			return "." + key
+		}
+	}
+	return elem
+}
@@ -0,0 +1,175 @@
+package geval
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Change : One write made by rule, Old is nil if the variable or map key did not exist before
+type Change struct {
+	Path string
+	Old  interface{}
+	New  interface{}
+}
+
+// undoLog : Record writes of a transactional eval so they can be rolled back
+type undoLog struct {
+	changes []Change
+	undos   []func()
+}
+
+// EvalTx : Run a node in transaction mode. Every write to variables, maps, slices and struct fields is recorded,
+// if eval fail all writes are rolled back, otherwise the change set is returned in write order.
+// Writes made inside called functions are not recorded
+func (ruleNode *RuleNode) EvalTx(dataCtx *DataContext) (changes []Change, err error) {
+	changes, _, err = ruleNode.evalTx(dataCtx, true)
+	return
+}
+
+// evalTx : Run node with writes recorded and get values of return statement. If rollback is false,
+// writes of failed eval are kept like Eval, and the partial change set is returned
+func (ruleNode *RuleNode) evalTx(dataCtx *DataContext, rollback bool) ([]Change, []interface{}, error) {
+	log := &undoLog{}
+	ev := ruleNode.newEvaluator(dataCtx)
+	ev.undoLog = log
+
+	err := ev.run()
+	if nil != err && rollback {
+		log.rollback()
+		return nil, ev.result, err
+	}
+	return log.changes, ev.result, err
+}
+
+// rollback : Undo writes in reverse order
+func (log *undoLog) rollback() {
+	for i := len(log.undos) - 1; i >= 0; i-- {
+		log.undos[i]()
+	}
+	log.undos = nil
+	log.changes = nil
+}
+
+func (log *undoLog) add(path string, old reflect.Value, value reflect.Value, undo func()) {
+	change := Change{Path: path}
+	if old.IsValid() {
+		change.Old = old.Interface()
+	}
+	if value.IsValid() && value.CanInterface() {
+		change.New = elemCopy(value.Interface())
+	}
+	log.changes = append(log.changes, change)
+	log.undos = append(log.undos, undo)
+}
+
+// recordIdent : Record assignment to variable name
+func (log *undoLog) recordIdent(ctx *DataContext, name string, value reflect.Value) {
+	data, owner, ok := ctx.lookup(name)
+	if !ok || owner != ctx && (ctx.isolated || reflect.Ptr != reflect.ValueOf(data).Kind()) {
+		// a new variable will be created in ctx, it shadows the parent's one if any
+		old := nilValue
+		if ok {
+			old = reflect.ValueOf(elemCopy(data))
+		}
+		log.add(name, old, value, func() {
+			delete(ctx.data, name)
+		})
+		return
+	}
+
+	vData := reflect.ValueOf(data)
+	if reflect.Ptr == vData.Kind() {
+		elem := vData.Elem()
+		old := copyValue(elem)
+		log.add(name, old, value, func() {
+			elem.Set(old)
+		})
+		return
+	}
+
+	log.add(name, vData, value, func() {
+		ctx.data[name] = data
+	})
+}
+
+// recordShadow : Remove copy of parent's variable made by nested write on rollback
+func (log *undoLog) recordShadow(ctx *DataContext, name string) {
+	log.undos = append(log.undos, func() {
+		delete(ctx.data, name)
+	})
+}
+
+// recordIndex : Record assignment to map or slice element
+func (log *undoLog) recordIndex(path string, vData reflect.Value, vIndex reflect.Value, value reflect.Value) {
+	vData = derefValue(vData)
+	switch vData.Kind() {
+	case reflect.Map:
+		vKey, err := mapKey(ptrElem(vIndex.Interface()), vData.Type().Key())
+		if nil != err {
+			return
+		}
+		old := vData.MapIndex(vKey)
+		if !old.IsValid() {
+			log.add(path, nilValue, value, func() {
+				vData.SetMapIndex(vKey, reflect.Value{})
+			})
+			return
+		}
+		old = copyValue(old)
+		log.add(path, old, value, func() {
+			vData.SetMapIndex(vKey, old)
+		})
+
+	case reflect.Slice:
+		i, err := valueIndex(vIndex)
+		if nil != err || i < 0 || i >= vData.Len() {
+			return
+		}
+		elem := vData.Index(i)
+		old := copyValue(elem)
+		log.add(path, old, value, func() {
+			elem.Set(old)
+		})
+	}
+}
+
+// recordSel : Record assignment to struct field
+func (log *undoLog) recordSel(path string, vData reflect.Value, field string, value reflect.Value) {
+	vData = derefValue(vData)
+	if reflect.Struct != vData.Kind() {
+		return
+	}
+	elem := vData.FieldByName(field)
+	if !elem.IsValid() || !elem.CanSet() {
+		return
+	}
+	old := copyValue(elem)
+	log.add(path, old, value, func() {
+		elem.Set(old)
+	})
+}
+
+// copyValue : Shallow copy of value, so later Set on the origin do not change it
+func copyValue(v reflect.Value) reflect.Value {
+	c := reflect.New(v.Type()).Elem()
+	c.Set(v)
+	return c
+}
+
+// derefValue : Walk through ptr and interface to the real value
+func derefValue(v reflect.Value) reflect.Value {
+	for reflect.Ptr == v.Kind() || reflect.Interface == v.Kind() {
+		v = v.Elem()
+	}
+	return v
+}
+
+// indexPath : Format evaluated index as path element, like `["key"]` or `[2]`
+func indexPath(index interface{}) string {
+	switch x := ptrElem(index).(type) {
+	case string:
+		return fmt.Sprintf("[%q]", x)
+	default:
+		return fmt.Sprintf("[%v]", x)
+	}
+}